@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package checkpoint turns collected ephemeral-storage/pids usage into the
+// recommendations persisted on a VerticalPodAutoscalerCheckpoint - the
+// cluster-visible record Lint already reads RSSSampleCount off of (see
+// recommender/lint/collector.go) - closing the gap where kubelet evicting a
+// container for disk or PID pressure produced a starvation signal (see
+// input/oom/starved_resource.go) but never an actual recommendation.
+package checkpoint
+
+import (
+	"fmt"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// headroomFraction is how much above the observed peak a recommendation's
+// limit is set above its request, so a container that's only ever grazed a
+// starvation threshold isn't immediately evicted again on its next spike.
+const headroomFraction = 0.2
+
+// EphemeralStorageAggregator tracks the peak ephemeral-storage and pids
+// usage observed per container. Unlike the recommender's cpu/memory
+// recommendation, which needs a decaying usage histogram to estimate a
+// percentile, ephemeral-storage/pids starvation is binary (evicted or not),
+// so the simplest useful recommendation is "the highest usage observed so
+// far plus headroom" rather than a percentile.
+type EphemeralStorageAggregator struct {
+	peak map[model.ContainerID]model.Resources
+}
+
+// NewEphemeralStorageAggregator returns an empty EphemeralStorageAggregator.
+func NewEphemeralStorageAggregator() *EphemeralStorageAggregator {
+	return &EphemeralStorageAggregator{peak: make(map[model.ContainerID]model.Resources)}
+}
+
+// AddSample folds one metrics collection cycle's usage into the running peak
+// for every container snapshot reports ResourceEphemeralStorage or
+// ResourcePID for; every other resource is out of scope for this aggregator.
+func (a *EphemeralStorageAggregator) AddSample(snapshot metrics.ContainerMetricsSnapshot) {
+	for _, resourceName := range []model.ResourceName{model.ResourceEphemeralStorage, model.ResourcePID} {
+		amount, ok := snapshot.Usage[resourceName]
+		if !ok {
+			continue
+		}
+		resources, ok := a.peak[snapshot.ContainerID]
+		if !ok {
+			resources = make(model.Resources)
+			a.peak[snapshot.ContainerID] = resources
+		}
+		if amount > resources[resourceName] {
+			resources[resourceName] = amount
+		}
+	}
+}
+
+// Recommendation returns the request/limit model.Resources this aggregator
+// recommends for container, derived from the peak usage observed for it so
+// far plus headroomFraction. ok is false if no sample has been recorded for
+// container yet.
+func (a *EphemeralStorageAggregator) Recommendation(container model.ContainerID) (request, limit model.Resources, ok bool) {
+	peak, ok := a.peak[container]
+	if !ok {
+		return nil, nil, false
+	}
+
+	request = make(model.Resources, len(peak))
+	limit = make(model.Resources, len(peak))
+	for resourceName, amount := range peak {
+		request[resourceName] = amount
+		limit[resourceName] = model.ResourceAmount(float64(amount) * (1 + headroomFraction))
+	}
+	return request, limit, true
+}
+
+// CheckpointWriter persists an ephemeral-storage recommendation onto a
+// container's VerticalPodAutoscalerCheckpoint. Like quota.ConditionSetter,
+// EphemeralStorageAggregator doesn't patch the checkpoint object itself: the
+// generated VerticalPodAutoscalerCheckpoint clientset isn't vendored into
+// this package (recommender/lint/collector.go reads checkpoints the same
+// way, through the dynamic client), so the caller that already holds it
+// supplies how the patch actually lands.
+type CheckpointWriter interface {
+	// WriteEphemeralStorageRecommendation records request/limit as
+	// container's ephemeral-storage recommendation on its
+	// VerticalPodAutoscalerCheckpoint.
+	WriteEphemeralStorageRecommendation(container model.ContainerID, request, limit model.ResourceAmount) error
+}
+
+// Flush writes every container's current ephemeral-storage recommendation
+// through writer, skipping containers with no ephemeral-storage usage
+// recorded (a container that's only ever reported pids usage has nothing to
+// recommend for ephemeral-storage).
+func (a *EphemeralStorageAggregator) Flush(writer CheckpointWriter) error {
+	for container := range a.peak {
+		request, limit, ok := a.Recommendation(container)
+		if !ok {
+			continue
+		}
+		storageRequest, hasStorage := request[model.ResourceEphemeralStorage]
+		if !hasStorage {
+			continue
+		}
+		if err := writer.WriteEphemeralStorageRecommendation(container, storageRequest, limit[model.ResourceEphemeralStorage]); err != nil {
+			return fmt.Errorf("writing ephemeral-storage recommendation for %s/%s container %s: %v", container.Namespace, container.PodName, container.ContainerName, err)
+		}
+	}
+	return nil
+}
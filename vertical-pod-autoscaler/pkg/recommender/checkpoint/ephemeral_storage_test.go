@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func TestRecommendationTracksPeakUsage(t *testing.T) {
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	a := NewEphemeralStorageAggregator()
+
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: container, Usage: model.Resources{model.ResourceEphemeralStorage: 1000}})
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: container, Usage: model.Resources{model.ResourceEphemeralStorage: 500}})
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: container, Usage: model.Resources{model.ResourceEphemeralStorage: 1500}})
+
+	request, limit, ok := a.Recommendation(container)
+	require.True(t, ok)
+	assert.Equal(t, model.ResourceAmount(1500), request[model.ResourceEphemeralStorage], "recommendation should track the peak, not the latest or average sample")
+	assert.Equal(t, model.ResourceAmount(1800), limit[model.ResourceEphemeralStorage], "limit should be peak usage plus headroom")
+}
+
+func TestRecommendationIgnoresUnrelatedResources(t *testing.T) {
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	a := NewEphemeralStorageAggregator()
+
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: container, Usage: model.Resources{model.ResourceRSS: 4096, model.ResourcePID: 42}})
+
+	request, _, ok := a.Recommendation(container)
+	require.True(t, ok)
+	assert.NotContains(t, request, model.ResourceRSS, "cpu/memory/RSS/JVM recommendations are out of scope for this aggregator")
+	assert.Contains(t, request, model.ResourcePID)
+}
+
+func TestRecommendationNoSamples(t *testing.T) {
+	a := NewEphemeralStorageAggregator()
+
+	_, _, ok := a.Recommendation(model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"})
+
+	assert.False(t, ok)
+}
+
+type fakeCheckpointWriter struct {
+	written map[model.ContainerID][2]model.ResourceAmount
+	err     error
+}
+
+func (f *fakeCheckpointWriter) WriteEphemeralStorageRecommendation(container model.ContainerID, request, limit model.ResourceAmount) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.written == nil {
+		f.written = make(map[model.ContainerID][2]model.ResourceAmount)
+	}
+	f.written[container] = [2]model.ResourceAmount{request, limit}
+	return nil
+}
+
+func TestFlushWritesOnlyContainersWithEphemeralStorageUsage(t *testing.T) {
+	withStorage := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-a"}, ContainerName: "c"}
+	pidsOnly := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-b"}, ContainerName: "c"}
+
+	a := NewEphemeralStorageAggregator()
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: withStorage, Usage: model.Resources{model.ResourceEphemeralStorage: 1000}})
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: pidsOnly, Usage: model.Resources{model.ResourcePID: 10}})
+
+	writer := &fakeCheckpointWriter{}
+	err := a.Flush(writer)
+	require.NoError(t, err)
+
+	require.Contains(t, writer.written, withStorage)
+	assert.Equal(t, [2]model.ResourceAmount{1000, 1200}, writer.written[withStorage])
+	assert.NotContains(t, writer.written, pidsOnly, "a container with no ephemeral-storage usage has nothing to recommend for it")
+}
+
+func TestFlushPropagatesWriterError(t *testing.T) {
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	a := NewEphemeralStorageAggregator()
+	a.AddSample(metrics.ContainerMetricsSnapshot{ContainerID: container, Usage: model.Resources{model.ResourceEphemeralStorage: 1000}})
+
+	writer := &fakeCheckpointWriter{err: assert.AnError}
+	err := a.Flush(writer)
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// ContainerMetricsSnapshot holds one container's usage across every resource
+// GetContainersMetrics collected for it.
+type ContainerMetricsSnapshot struct {
+	ContainerID model.ContainerID
+	Usage       model.Resources
+}
+
+// PrometheusClient is the subset of a Prometheus HTTP API client
+// MetricsClient needs: resolving which pods in a namespace currently have
+// live series (the label-values discovery query from the batching
+// redesign), and executing a single nsQuery's PromQL string.
+type PrometheusClient interface {
+	// LabelValues returns the pod names with a live series for metric in
+	// namespace, e.g. label_values(container_memory_rss{namespace='X'}, pod).
+	LabelValues(metric, namespace string) ([]string, error)
+	// Query executes a PromQL query and returns, for each matching series,
+	// the container it belongs to and the sampled value.
+	Query(promQL string) (map[model.ContainerID]model.ResourceAmount, error)
+}
+
+// MetricsClient collects container resource usage for the recommender. The
+// resources it reports are exactly those of the query builders enabled by
+// --custom-metric-queries (rss and jvm_heap_committed by default), resolved
+// through the RegisterQueryBuilder registry; cpu and memory usage are not
+// collected here.
+type MetricsClient struct {
+	prometheusClient   PrometheusClient
+	containerNameLabel prommodel.LabelName
+	podNameLabel       prommodel.LabelName
+	chunkSizeCache     *chunkSizeCache
+
+	// namespacePods is the VPA-tracked pods per namespace; the caller (the
+	// cluster feeder) is expected to keep this current as pods come and go.
+	namespacePods map[string][]string
+}
+
+// NewMetricsClient creates a MetricsClient that queries Prometheus through
+// prometheusClient, labeling queries with containerNameLabel/podNameLabel.
+func NewMetricsClient(prometheusClient PrometheusClient, containerNameLabel, podNameLabel prommodel.LabelName) *MetricsClient {
+	return &MetricsClient{
+		prometheusClient:   prometheusClient,
+		containerNameLabel: containerNameLabel,
+		podNameLabel:       podNameLabel,
+		chunkSizeCache:     newChunkSizeCache(),
+		namespacePods:      make(map[string][]string),
+	}
+}
+
+// UpdateNamespacePods replaces the set of VPA-tracked pods GetContainersMetrics
+// queries for in namespace.
+func (c *MetricsClient) UpdateNamespacePods(namespace string, podNames []string) {
+	c.namespacePods[namespace] = podNames
+}
+
+// GetContainersMetrics fans out over the query builders enabled by
+// --custom-metric-queries (falling back to the registry's "rss" and
+// "jvm_heap_committed" builtins when the flag is unset) and returns one
+// ContainerMetricsSnapshot per container that reported usage for at least
+// one resource.
+func (c *MetricsClient) GetContainersMetrics() ([]ContainerMetricsSnapshot, error) {
+	builders, err := enabledQueryBuilders(parseCustomMetricQueryNames(*CustomMetricQueries), c.containerNameLabel, c.podNameLabel)
+	if err != nil {
+		return nil, fmt.Errorf("resolving --custom-metric-queries: %v", err)
+	}
+
+	usage := make(map[model.ContainerID]model.Resources)
+	for namespace, trackedPods := range c.namespacePods {
+		if len(trackedPods) == 0 {
+			continue
+		}
+		discovered, err := c.prometheusClient.LabelValues("container_memory_rss", namespace)
+		if err != nil {
+			return nil, fmt.Errorf("discovering live pods in namespace %s: %v", namespace, err)
+		}
+		freshPods := intersectPodNames(trackedPods, discovered)
+		if len(freshPods) == 0 {
+			continue
+		}
+
+		for _, builder := range builders {
+			for _, query := range builder.buildBatch(freshPods, namespace, c.chunkSizeCache) {
+				start := time.Now()
+				samples, err := c.prometheusClient.Query(query.query)
+				c.chunkSizeCache.recordQueryLatency(namespace, len(query.pods), time.Since(start))
+				if err != nil {
+					return nil, fmt.Errorf("querying %s in namespace %s: %v", query.resource, namespace, err)
+				}
+				for containerID, amount := range samples {
+					if usage[containerID] == nil {
+						usage[containerID] = make(model.Resources)
+					}
+					usage[containerID][model.ResourceName(query.resource)] = amount
+				}
+			}
+		}
+	}
+
+	snapshots := make([]ContainerMetricsSnapshot, 0, len(usage))
+	for containerID, resources := range usage {
+		snapshots = append(snapshots, ContainerMetricsSnapshot{ContainerID: containerID, Usage: resources})
+	}
+	return snapshots, nil
+}
@@ -17,13 +17,102 @@ limitations under the License.
 package metrics
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	prommodel "github.com/prometheus/common/model"
+
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 )
 
+// fakePrometheusClient backs PrometheusClient with canned responses instead
+// of a real Prometheus HTTP API: livePods is returned from every LabelValues
+// call for the matching namespace, and samples is keyed by a substring of
+// the metric name (e.g. "container_memory_rss") so a single fake can answer
+// queries from every registered builder.
+type fakePrometheusClient struct {
+	livePods map[string][]string
+	samples  map[string]map[model.ContainerID]model.ResourceAmount
+}
+
+func (f *fakePrometheusClient) LabelValues(metric, namespace string) ([]string, error) {
+	return f.livePods[namespace], nil
+}
+
+func (f *fakePrometheusClient) Query(promQL string) (map[model.ContainerID]model.ResourceAmount, error) {
+	for metric, result := range f.samples {
+		if strings.Contains(promQL, metric) {
+			return result, nil
+		}
+	}
+	return map[model.ContainerID]model.ResourceAmount{}, nil
+}
+
+// metricsClientTestCase bundles a fakePrometheusClient with the
+// namespace/pod tracking a test wants MetricsClient to see, plus the
+// snapshots GetContainersMetrics is expected to return for it.
+type metricsClientTestCase struct {
+	namespace   string
+	trackedPods []string
+	prom        *fakePrometheusClient
+	wantSnaps   []ContainerMetricsSnapshot
+}
+
+func newEmptyMetricsClientTestCase() *metricsClientTestCase {
+	return &metricsClientTestCase{
+		prom: &fakePrometheusClient{livePods: map[string][]string{}, samples: map[string]map[model.ContainerID]model.ResourceAmount{}},
+	}
+}
+
+func newMetricsClientTestCase() *metricsClientTestCase {
+	namespace := "default"
+	pod1 := model.PodID{Namespace: namespace, PodName: "pod-1"}
+	pod2 := model.PodID{Namespace: namespace, PodName: "pod-2"}
+	pod3 := model.PodID{Namespace: namespace, PodName: "pod-3"}
+	container1 := model.ContainerID{PodID: pod1, ContainerName: "app"}
+	container2 := model.ContainerID{PodID: pod2, ContainerName: "app"}
+	container3 := model.ContainerID{PodID: pod3, ContainerName: "app"}
+
+	return &metricsClientTestCase{
+		namespace:   namespace,
+		trackedPods: []string{pod1.PodName, pod2.PodName, pod3.PodName},
+		prom: &fakePrometheusClient{
+			livePods: map[string][]string{namespace: {pod1.PodName, pod2.PodName, pod3.PodName}},
+			samples: map[string]map[model.ContainerID]model.ResourceAmount{
+				// container_memory_rss: the default "rss" builder's metric.
+				"container_memory_rss": {
+					container1: model.ResourceAmount(1024),
+					container2: model.ResourceAmount(2048),
+				},
+				// jmx_Memory_HeapMemoryUsage_committed: the default
+				// "jvm_heap_committed" builder's metric. container3 never
+				// shows up in either query, e.g. because its series expired.
+				"jmx_Memory_HeapMemoryUsage_committed": {
+					container1: model.ResourceAmount(4096),
+				},
+			},
+		},
+		wantSnaps: []ContainerMetricsSnapshot{
+			{ContainerID: container1, Usage: model.Resources{model.ResourceRSS: 1024, model.ResourceJVMHeapCommitted: 4096}},
+			{ContainerID: container2, Usage: model.Resources{model.ResourceRSS: 2048}},
+		},
+	}
+}
+
+func (tc *metricsClientTestCase) createFakeMetricsClient() *MetricsClient {
+	client := NewMetricsClient(tc.prom, prommodel.LabelName("name"), prommodel.LabelName("pod_name"))
+	if tc.namespace != "" {
+		client.UpdateNamespacePods(tc.namespace, tc.trackedPods)
+	}
+	return client
+}
+
+func (tc *metricsClientTestCase) getAllSnaps() []ContainerMetricsSnapshot {
+	return tc.wantSnaps
+}
+
 func TestGetContainersMetricsReturnsEmptyList(t *testing.T) {
 	tc := newEmptyMetricsClientTestCase()
 	emptyMetricsClient := tc.createFakeMetricsClient()
@@ -54,12 +143,9 @@ func TestGetContainersMetricsIgnoresNoUsage(t *testing.T) {
 	snapshots, err := fakeMetricsClient.GetContainersMetrics()
 
 	assert.NoError(t, err)
-	assert.Len(t, snapshots, len(tc.getAllSnaps()), "It should return right number of snapshots")
+	assert.Len(t, snapshots, len(tc.getAllSnaps()), "a container with no samples in any enabled query should not appear")
 	for _, snap := range snapshots {
-		assert.Len(t, snap.Usage, 3, "It should return only CPU, Memory and RSS usage")
-		assert.Contains(t, snap.Usage, model.ResourceCPU, "CPU usage should be present")
-		assert.Contains(t, snap.Usage, model.ResourceMemory, "Memory usage should be present")
 		assert.Contains(t, snap.Usage, model.ResourceRSS, "RSS usage should be present")
-		assert.NotContains(t, snap.Usage, model.ResourceJVMHeapCommitted, "JVM Heap Committed usage should not be present")
+		assert.NotEqual(t, "pod-3", snap.ContainerID.PodName, "container3 had no usage and should have been dropped")
 	}
 }
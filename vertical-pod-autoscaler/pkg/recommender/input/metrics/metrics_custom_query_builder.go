@@ -26,11 +26,6 @@ import (
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 )
 
-// batchSize is capped at 500 to avoid DFA state explosion in the M3 queries.
-// For a given ns query, caps the number of pods OR'd in the regex podNameLabel,
-// e.g. custom_query{namespace='namespace',pod_name=~'pod1|pod2|...|pod500'}.
-const batchSize = 500
-
 // podsBatch is a batch of pod names.
 type podsBatch []string
 
@@ -45,97 +40,144 @@ type nsQuery struct {
 }
 
 // nsQueryBuilder is an interface for building a custom resource query.
+//
+// nsQueryBuilder is a public extension point: callers that need to drive VPA
+// recommendations off of a metric this package doesn't know about can
+// implement the interface and make it available via RegisterQueryBuilder,
+// rather than forking the recommender.
 type nsQueryBuilder interface {
-	// buildBatch builds a batch of queries for a list of pod names in a namespace.
-	buildBatch(podNames []string, namespace string) []nsQuery
+	// buildBatch builds a batch of queries for a list of pod names in a
+	// namespace, sharded per cache's current chunk size for that namespace.
+	buildBatch(podNames []string, namespace string, cache *chunkSizeCache) []nsQuery
 	// buildRaw builds a single query for a list of pod names in a namespace.
 	buildRaw(podNames []string, namespace string) nsQuery
 }
 
-// rssQueryBuilder implements the nsQueryBuilder interface for the RSS metric.
-type rssQueryBuilder struct {
-	resource           k8sapiv1.ResourceName
-	containerNameLabel prommodel.LabelName
-	podNameLabel       prommodel.LabelName
+// queryBuilderFactory creates an nsQueryBuilder bound to a pair of Prometheus
+// label names, for a single named custom metric.
+type queryBuilderFactory func(containerLabel, podLabel prommodel.LabelName) nsQueryBuilder
+
+var queryBuilderRegistry = map[string]struct {
+	resource model.ResourceName
+	factory  queryBuilderFactory
+}{}
+
+// RegisterQueryBuilder registers a named nsQueryBuilder factory for the given
+// resource so it can be selected via the --custom-metric-queries flag.
+// Built-in query builders (rss, jvm_heap_committed, jvm_heap_used,
+// jvm_non_heap_committed, jvm_metaspace_used, jvm_direct_memory_used,
+// jvm_gc_pause_seconds, gpu_memory, ephemeral_storage, pids) are
+// registered automatically on package init; callers wanting to support
+// additional metrics should call RegisterQueryBuilder from an init() in
+// their own package before the recommender starts.
+//
+// Registering the same name twice overwrites the previous registration,
+// which makes it possible for a caller to override a built-in.
+func RegisterQueryBuilder(name string, resource model.ResourceName, factory func(containerLabel, podLabel prommodel.LabelName) nsQueryBuilder) {
+	queryBuilderRegistry[name] = struct {
+		resource model.ResourceName
+		factory  queryBuilderFactory
+	}{resource: resource, factory: factory}
 }
 
-// jvmHeapCommittedQueryBuilder implements the nsQueryBuilder interface for the JVM Heap Committed metric.
-type jvmHeapCommittedQueryBuilder struct {
+// genericQueryBuilder implements nsQueryBuilder by formatting a single
+// metric/namespace-label pair into the usual shape:
+//
+//	max_over_time(metric{containerLabel!='', podLabel=~'^(p1|p2)$', nsLabel='namespace'}[rangeVector])
+//
+// All of the built-in query builders below are genericQueryBuilders; the
+// indirection through RegisterQueryBuilder exists so that a caller can
+// plug in something that doesn't fit this shape (e.g. a PromQL function
+// other than max_over_time, or a non-regex pod selector) without needing
+// a code change here.
+type genericQueryBuilder struct {
 	resource           k8sapiv1.ResourceName
+	metric             string
+	nsLabel            prommodel.LabelName
+	rangeVector        string
 	containerNameLabel prommodel.LabelName
 	podNameLabel       prommodel.LabelName
 }
 
-func regexOr(values []string) string {
-	return strings.Join(values, "|")
-}
-
-func getRSSQuery(containerNameLabel prommodel.LabelName, podNameLabel prommodel.LabelName) nsQueryBuilder {
-	return &rssQueryBuilder{
-		resource:           k8sapiv1.ResourceName(model.ResourceRSS),
-		containerNameLabel: containerNameLabel,
-		podNameLabel:       podNameLabel,
-	}
-}
-
-func getJVMHeapCommittedQuery(containerNameLabel prommodel.LabelName, podNameLabel prommodel.LabelName) nsQueryBuilder {
-	return &jvmHeapCommittedQueryBuilder{
-		resource:           k8sapiv1.ResourceName(model.ResourceJVMHeapCommitted),
-		containerNameLabel: containerNameLabel,
-		podNameLabel:       podNameLabel,
+func newGenericQueryBuilder(resource model.ResourceName, metric string, nsLabel prommodel.LabelName, rangeVector string) queryBuilderFactory {
+	return func(containerNameLabel, podNameLabel prommodel.LabelName) nsQueryBuilder {
+		return &genericQueryBuilder{
+			resource:           k8sapiv1.ResourceName(resource),
+			metric:             metric,
+			nsLabel:            nsLabel,
+			rangeVector:        rangeVector,
+			containerNameLabel: containerNameLabel,
+			podNameLabel:       podNameLabel,
+		}
 	}
 }
 
-// batchPodNames splits the list of pod names into batches of batchSize.
-func batchPodNames(podNames []string) []podsBatch {
-	batches := []podsBatch{}
-	for start := 0; start < len(podNames); start += batchSize {
-		end := start + batchSize
-		if end > len(podNames) {
-			end = len(podNames)
-		}
-
-		batches = append(batches, podNames[start:end])
-	}
-	return batches
+func regexOr(values []string) string {
+	return strings.Join(values, "|")
 }
 
-func (r *rssQueryBuilder) buildBatch(podNames []string, namespace string) []nsQuery {
-	batches := batchPodNames(podNames)
+func (g *genericQueryBuilder) buildBatch(podNames []string, namespace string, cache *chunkSizeCache) []nsQuery {
+	batches := shardPodNames(podNames, namespace, cache)
 	queries := []nsQuery{}
 	for _, batch := range batches {
-		queries = append(queries, r.buildRaw(batch, namespace))
+		queries = append(queries, g.buildRaw(batch, namespace))
 	}
 	return queries
 }
 
-func (r *rssQueryBuilder) buildRaw(podNames []string, namespace string) nsQuery {
+func (g *genericQueryBuilder) buildRaw(podNames []string, namespace string) nsQuery {
+	// The pod-name regex is anchored (^(...)$) rather than left as a bare
+	// alternation: an unanchored pod_name=~'p1|p2' also matches any pod whose
+	// name merely contains p1/p2 as a substring, and forces Prometheus/M3 to
+	// compile a larger DFA than necessary.
 	return nsQuery{
-		query:              fmt.Sprintf("max_over_time(container_memory_rss{%s!='', %s=~'%s', namespace='%s'}[5m])", r.containerNameLabel, r.podNameLabel, regexOr(podNames), namespace),
-		resource:           r.resource,
+		query:              fmt.Sprintf("max_over_time(%s{%s!='', %s=~'^(%s)$', %s='%s'}[%s])", g.metric, g.containerNameLabel, g.podNameLabel, regexOr(podNames), g.nsLabel, namespace, g.rangeVector),
+		resource:           g.resource,
 		pods:               podNames,
 		namespace:          namespace,
-		containerNameLabel: r.containerNameLabel,
-		podNameLabel:       r.podNameLabel,
+		containerNameLabel: g.containerNameLabel,
+		podNameLabel:       g.podNameLabel,
 	}
 }
 
-func (j *jvmHeapCommittedQueryBuilder) buildBatch(podNames []string, namespace string) []nsQuery {
-	batches := batchPodNames(podNames)
-	queries := []nsQuery{}
-	for _, batch := range batches {
-		queries = append(queries, j.buildRaw(batch, namespace))
-	}
-	return queries
+func init() {
+	RegisterQueryBuilder("rss", model.ResourceRSS,
+		newGenericQueryBuilder(model.ResourceRSS, "container_memory_rss", "namespace", "5m"))
+	RegisterQueryBuilder("jvm_heap_committed", model.ResourceJVMHeapCommitted,
+		newGenericQueryBuilder(model.ResourceJVMHeapCommitted, "jmx_Memory_HeapMemoryUsage_committed", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("jvm_heap_used", model.ResourceJVMHeapUsed,
+		newGenericQueryBuilder(model.ResourceJVMHeapUsed, "jmx_Memory_HeapMemoryUsage_used", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("jvm_non_heap_committed", model.ResourceJVMNonHeapCommitted,
+		newGenericQueryBuilder(model.ResourceJVMNonHeapCommitted, "jmx_Memory_NonHeapMemoryUsage_committed", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("jvm_metaspace_used", model.ResourceJVMMetaspaceUsed,
+		newGenericQueryBuilder(model.ResourceJVMMetaspaceUsed, "jmx_MemoryPool_Metaspace_Usage_used", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("jvm_direct_memory_used", model.ResourceJVMDirectMemoryUsed,
+		newGenericQueryBuilder(model.ResourceJVMDirectMemoryUsed, "jmx_BufferPool_direct_MemoryUsed", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("jvm_gc_pause_seconds", model.ResourceJVMGCPauseSeconds,
+		newGenericQueryBuilder(model.ResourceJVMGCPauseSeconds, "jvm_gc_pause_seconds_sum", "kubernetes_namespace", "5m"))
+	RegisterQueryBuilder("gpu_memory", model.ResourceGPUMemory,
+		newGenericQueryBuilder(model.ResourceGPUMemory, "DCGM_FI_DEV_FB_USED", "namespace", "5m"))
+	RegisterQueryBuilder("ephemeral_storage", model.ResourceEphemeralStorage,
+		newGenericQueryBuilder(model.ResourceEphemeralStorage, "container_fs_usage_bytes", "namespace", "5m"))
+	RegisterQueryBuilder("pids", model.ResourcePID,
+		newGenericQueryBuilder(model.ResourcePID, "container_processes", "namespace", "5m"))
 }
 
-func (j *jvmHeapCommittedQueryBuilder) buildRaw(podNames []string, namespace string) nsQuery {
-	return nsQuery{
-		query:              fmt.Sprintf("max_over_time(jmx_Memory_HeapMemoryUsage_committed{%s!='', %s=~'%s', kubernetes_namespace='%s'}[5m])", j.containerNameLabel, j.podNameLabel, regexOr(podNames), namespace),
-		resource:           j.resource,
-		pods:               podNames,
-		namespace:          namespace,
-		containerNameLabel: j.containerNameLabel,
-		podNameLabel:       j.podNameLabel,
+// enabledQueryBuilders resolves the --custom-metric-queries names (e.g.
+// "rss,jvm_heap_committed,jvm_heap_used,gpu_memory") against the registry and
+// returns the corresponding builders bound to containerNameLabel/podNameLabel.
+// GetContainersMetrics fans out over the returned builders instead of the two
+// that used to be hard-coded. Unknown names are reported as an error, so
+// every GetContainersMetrics call fails on a misconfigured flag rather than
+// silently recommending nothing for a custom resource.
+func enabledQueryBuilders(names []string, containerNameLabel, podNameLabel prommodel.LabelName) ([]nsQueryBuilder, error) {
+	builders := make([]nsQueryBuilder, 0, len(names))
+	for _, name := range names {
+		entry, ok := queryBuilderRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("no query builder registered for custom metric %q", name)
+		}
+		builders = append(builders, entry.factory(containerNameLabel, podNameLabel))
 	}
+	return builders, nil
 }
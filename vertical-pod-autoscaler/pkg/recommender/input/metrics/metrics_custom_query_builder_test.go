@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	prommodel "github.com/prometheus/common/model"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func TestRegisterQueryBuilderOverridesBuiltin(t *testing.T) {
+	var called bool
+	RegisterQueryBuilder("rss", model.ResourceRSS, func(containerLabel, podLabel prommodel.LabelName) nsQueryBuilder {
+		called = true
+		return newGenericQueryBuilder(model.ResourceRSS, "container_memory_rss", "namespace", "5m")(containerLabel, podLabel)
+	})
+	// restore the built-in immediately so other tests in this package aren't affected.
+	defer func() {
+		RegisterQueryBuilder("rss", model.ResourceRSS,
+			newGenericQueryBuilder(model.ResourceRSS, "container_memory_rss", "namespace", "5m"))
+	}()
+
+	builders, err := enabledQueryBuilders([]string{"rss"}, "container", "pod")
+	assert.NoError(t, err)
+	assert.Len(t, builders, 1)
+	assert.True(t, called, "overriding factory should have been invoked")
+}
+
+func TestEnabledQueryBuildersUnknownName(t *testing.T) {
+	_, err := enabledQueryBuilders([]string{"does_not_exist"}, "container", "pod")
+
+	assert.Error(t, err)
+}
+
+func TestEnabledQueryBuildersBuildsRegisteredSet(t *testing.T) {
+	builders, err := enabledQueryBuilders([]string{"rss", "jvm_heap_used", "gpu_memory"}, "container", "pod")
+
+	assert.NoError(t, err)
+	assert.Len(t, builders, 3)
+}
+
+func TestParseCustomMetricQueryNames(t *testing.T) {
+	assert.Equal(t, []string{"rss", "jvm_heap_committed"}, parseCustomMetricQueryNames("rss, jvm_heap_committed,"))
+	assert.Equal(t, []string{}, parseCustomMetricQueryNames(""))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"flag"
+	"strings"
+)
+
+// CustomMetricQueries is the --custom-metric-queries flag: a comma separated
+// list of names previously registered with RegisterQueryBuilder, e.g.
+// "rss,jvm_heap_committed,jvm_heap_used,gpu_memory". It replaces the old
+// behavior of always querying RSS and JVM heap committed for every pod.
+var CustomMetricQueries = flag.String("custom-metric-queries", "rss,jvm_heap_committed",
+	"Comma separated list of custom metric query builders to enable, e.g. rss,jvm_heap_committed,jvm_heap_used,gpu_memory. "+
+		"See metrics.RegisterQueryBuilder for how to add a query builder that isn't built in.")
+
+// parseCustomMetricQueryNames splits and trims the --custom-metric-queries
+// flag value, dropping empty entries so a trailing comma or an unset flag
+// doesn't register a builder for the empty string.
+func parseCustomMetricQueryNames(flagValue string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(flagValue, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "vpa_recommender"
+
+var (
+	promQueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "prom_query_duration_seconds",
+			Help:      "Time spent waiting for a Prometheus custom-metric query to return, by namespace.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"namespace"},
+	)
+	promBatchSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "prom_batch_size",
+			Help:      "Number of pods included in the most recent pod-name shard queried for a namespace.",
+		}, []string{"namespace"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(promQueryDuration)
+	prometheus.MustRegister(promBatchSize)
+}
+
+// Tuning constants for adaptive shard sizing. targetQueryLatency is the
+// latency a shard size is considered "right" for; chunkSize backs off
+// toward minChunkSize on timeout-shaped slow queries and grows back toward
+// maxChunkSize once queries are comfortably under target again.
+const (
+	minChunkSize       = 50
+	maxChunkSize       = 500
+	defaultChunkSize   = 500
+	targetQueryLatency = 200 * time.Millisecond
+)
+
+// chunkSizeCache remembers, per namespace, the shard size that worked last
+// time so shardPodNames doesn't have to relearn it on every scrape cycle.
+type chunkSizeCache struct {
+	mu    sync.Mutex
+	sizes map[string]int
+}
+
+// newChunkSizeCache returns an empty cache; namespaces default to
+// defaultChunkSize until recordQueryLatency adjusts them.
+func newChunkSizeCache() *chunkSizeCache {
+	return &chunkSizeCache{sizes: make(map[string]int)}
+}
+
+func (c *chunkSizeCache) get(namespace string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size, ok := c.sizes[namespace]; ok {
+		return size
+	}
+	return defaultChunkSize
+}
+
+// recordQueryLatency adjusts the cached chunk size for namespace based on how
+// long a query against a chunk of that size just took, and reports the
+// vpa_recommender_prom_query_duration_seconds/vpa_recommender_prom_batch_size
+// metrics for it. Queries that blew past targetQueryLatency shrink the next
+// chunk size toward minChunkSize; comfortably fast queries grow it back
+// toward maxChunkSize so a namespace that gets less crowded recovers the
+// larger, more efficient shard size.
+func (c *chunkSizeCache) recordQueryLatency(namespace string, chunkSize int, latency time.Duration) {
+	promQueryDuration.WithLabelValues(namespace).Observe(latency.Seconds())
+	promBatchSize.WithLabelValues(namespace).Set(float64(chunkSize))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := chunkSize
+	if latency > targetQueryLatency {
+		next = chunkSize / 2
+		if next < minChunkSize {
+			next = minChunkSize
+		}
+	} else if latency < targetQueryLatency/2 && chunkSize < maxChunkSize {
+		next = chunkSize * 2
+		if next > maxChunkSize {
+			next = maxChunkSize
+		}
+	}
+	c.sizes[namespace] = next
+}
+
+// intersectPodNames returns the pods that are both tracked by VPA and
+// reported as having live series by Prometheus's label_values, preserving
+// trackedPodNames' order. This replaces querying every VPA-tracked pod name
+// unconditionally: a pod with no fresh samples just wastes space in the
+// regex and gets re-transmitted every interval for nothing.
+func intersectPodNames(trackedPodNames, discoveredPodNames []string) []string {
+	discovered := make(map[string]bool, len(discoveredPodNames))
+	for _, pod := range discoveredPodNames {
+		discovered[pod] = true
+	}
+
+	fresh := make([]string, 0, len(trackedPodNames))
+	for _, pod := range trackedPodNames {
+		if discovered[pod] {
+			fresh = append(fresh, pod)
+		}
+	}
+	return fresh
+}
+
+// shardPodNames splits podNames into batches sized by the cache's current
+// chunk size for namespace, rather than a fixed batch size - this is what
+// genericQueryBuilder.buildBatch calls instead of OR-ing every tracked pod
+// into one regex.
+func shardPodNames(podNames []string, namespace string, cache *chunkSizeCache) []podsBatch {
+	chunkSize := cache.get(namespace)
+	batches := []podsBatch{}
+	for start := 0; start < len(podNames); start += chunkSize {
+		end := start + chunkSize
+		if end > len(podNames) {
+			end = len(podNames)
+		}
+		batches = append(batches, podNames[start:end])
+	}
+	return batches
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntersectPodNamesDropsStalePods(t *testing.T) {
+	tracked := []string{"pod-1", "pod-2", "pod-3"}
+	discovered := []string{"pod-1", "pod-3"}
+
+	fresh := intersectPodNames(tracked, discovered)
+
+	assert.Equal(t, []string{"pod-1", "pod-3"}, fresh)
+}
+
+func TestChunkSizeCacheDefaultsBeforeAnyRecord(t *testing.T) {
+	cache := newChunkSizeCache()
+
+	assert.Equal(t, defaultChunkSize, cache.get("ns"))
+}
+
+func TestChunkSizeCacheShrinksOnSlowQuery(t *testing.T) {
+	cache := newChunkSizeCache()
+
+	cache.recordQueryLatency("ns", defaultChunkSize, 2*time.Second)
+
+	assert.Less(t, cache.get("ns"), defaultChunkSize)
+	assert.GreaterOrEqual(t, cache.get("ns"), minChunkSize)
+}
+
+func TestChunkSizeCacheGrowsBackOnFastQuery(t *testing.T) {
+	cache := newChunkSizeCache()
+	cache.recordQueryLatency("ns", defaultChunkSize, 2*time.Second)
+	shrunk := cache.get("ns")
+
+	cache.recordQueryLatency("ns", shrunk, 10*time.Millisecond)
+
+	assert.Greater(t, cache.get("ns"), shrunk)
+}
+
+func TestChunkSizeCacheIsPerNamespace(t *testing.T) {
+	cache := newChunkSizeCache()
+
+	cache.recordQueryLatency("busy-ns", defaultChunkSize, 2*time.Second)
+
+	assert.Less(t, cache.get("busy-ns"), defaultChunkSize)
+	assert.Equal(t, defaultChunkSize, cache.get("quiet-ns"))
+}
+
+func TestShardPodNamesUsesCachedChunkSize(t *testing.T) {
+	cache := newChunkSizeCache()
+	cache.recordQueryLatency("ns", defaultChunkSize, 2*time.Second) // shrinks to 250
+
+	podNames := make([]string, 300)
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("pod-%d", i)
+	}
+
+	batches := shardPodNames(podNames, "ns", cache)
+
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0], cache.get("ns"))
+}
+
+func BenchmarkShardPodNamesLargeNamespace(b *testing.B) {
+	cache := newChunkSizeCache()
+	podNames := make([]string, 2000)
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("pod-%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		shardPodNames(podNames, "benchmark-ns", cache)
+	}
+}
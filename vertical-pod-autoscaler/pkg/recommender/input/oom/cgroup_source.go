@@ -0,0 +1,241 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// OomSourceMode selects which OomSource implementation(s) feed the Observer.
+type OomSourceMode string
+
+const (
+	// OomSourcePod derives OOM events from pod status, as Observer.OnUpdate
+	// already does (pod.Status.ContainerStatuses.LastTerminationState).
+	OomSourcePod OomSourceMode = "pod"
+	// OomSourceCgroup derives OOM events from cgroup v2 memory.events/memory.peak
+	// read directly off the node, via CgroupOomReader.
+	OomSourceCgroup OomSourceMode = "cgroup"
+	// OomSourceBoth runs both sources and dedupes events seen by both.
+	OomSourceBoth OomSourceMode = "both"
+)
+
+// OomSourceFlag is the --oom-source flag. Kept as a string flag rather than a
+// custom flag.Value so it round-trips cleanly through component config files.
+var OomSourceFlag = flag.String("oom-source", string(OomSourcePod),
+	"Source of OOM events: pod (parse pod status, the historical behavior), cgroup (read cgroup v2 memory.events/memory.peak from the node), or both.")
+
+// dedupeWindow is how close two OOM events for the same container need to be
+// in time to be considered the same kill observed by two sources.
+const dedupeWindow = 5 * time.Second
+
+// cgroupMemoryEventsReader reads a single container's cgroup v2 memory.events
+// and memory.peak files. It's a thin interface over the filesystem so tests
+// can substitute an in-memory reader instead of needing a real cgroupfs.
+type cgroupMemoryEventsReader interface {
+	// ReadOomCount returns the cumulative "oom" and "oom_kill" counters from
+	// memory.events for the given cgroup path.
+	ReadOomCount(cgroupPath string) (oom, oomKill int64, err error)
+	// ReadPeakMemory returns memory.peak (the high-water mark RSS+cache since
+	// the cgroup was created or last reset) for the given cgroup path.
+	ReadPeakMemory(cgroupPath string) (model.ResourceAmount, error)
+}
+
+// fsCgroupMemoryEventsReader implements cgroupMemoryEventsReader by reading
+// directly from a mounted cgroup v2 hierarchy, as a node-local DaemonSet would.
+type fsCgroupMemoryEventsReader struct{}
+
+// NewFsCgroupMemoryEventsReader returns a cgroupMemoryEventsReader backed by the
+// real cgroupfs. It's meant to run inside a DaemonSet pod with the host's
+// /sys/fs/cgroup bind-mounted in, one reader per node.
+func NewFsCgroupMemoryEventsReader() cgroupMemoryEventsReader {
+	return &fsCgroupMemoryEventsReader{}
+}
+
+func (r *fsCgroupMemoryEventsReader) ReadOomCount(cgroupPath string) (int64, int64, error) {
+	f, err := os.Open(filepath.Join(cgroupPath, "memory.events"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var oom, oomKill int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "oom":
+			oom = value
+		case "oom_kill":
+			oomKill = value
+		}
+	}
+	return oom, oomKill, scanner.Err()
+}
+
+func (r *fsCgroupMemoryEventsReader) ReadPeakMemory(cgroupPath string) (model.ResourceAmount, error) {
+	raw, err := os.ReadFile(filepath.Join(cgroupPath, "memory.peak"))
+	if err != nil {
+		return 0, err
+	}
+	peak, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing memory.peak: %v", err)
+	}
+	return model.ResourceAmount(peak), nil
+}
+
+// CgroupOomSource watches the cgroup v2 memory controller for the containers
+// it's told about and emits OomInfo with Memory set to the true peak RSS at
+// kill time (memory.peak), instead of the container's memory request that
+// pod-status-based detection has to fall back to.
+type CgroupOomSource struct {
+	reader cgroupMemoryEventsReader
+	// lastOomKill tracks the last-seen oom_kill counter per container so a
+	// poll loop can detect the counter incrementing and emit exactly one
+	// OomInfo per new kill.
+	lastOomKill map[model.ContainerID]int64
+}
+
+// NewCgroupOomSource creates a CgroupOomSource backed by reader. Pass
+// NewFsCgroupMemoryEventsReader() in production; tests can supply a fake.
+func NewCgroupOomSource(reader cgroupMemoryEventsReader) *CgroupOomSource {
+	return &CgroupOomSource{
+		reader:      reader,
+		lastOomKill: make(map[model.ContainerID]int64),
+	}
+}
+
+// Poll checks cgroupPath for container and, if its oom_kill counter has
+// incremented since the last Poll, returns a single OomInfo for the new kill
+// with Memory set from memory.peak. Returns nil if there was no new kill.
+//
+// The caller is expected to call Poll periodically (e.g. every few seconds)
+// for every container it knows the cgroup path of, and forward non-nil
+// results into Observer.observedOomsChannel the same way OnUpdate does for
+// pod-status-derived events.
+func (s *CgroupOomSource) Poll(container model.ContainerID, cgroupPath string, now time.Time) (*OomInfo, error) {
+	_, oomKill, err := s.reader.ReadOomCount(cgroupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := s.lastOomKill[container]
+	s.lastOomKill[container] = oomKill
+	if oomKill <= previous {
+		return nil, nil
+	}
+
+	peak, err := s.reader.ReadPeakMemory(cgroupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OomInfo{
+		Timestamp:   now,
+		Memory:      peak,
+		Resource:    model.ResourceMemory,
+		ContainerID: container,
+	}, nil
+}
+
+// mergeOomEvents combines OOM events observed by the pod-status source and
+// the cgroup source, dropping cgroup events that are really the same kill as
+// a pod-status event already in podEvents. Two events are considered the same
+// kill if they share a ContainerID and their timestamps are within
+// dedupeWindow of each other. Pod-status events are preferred verbatim on a
+// match; cgroup-only events are kept as-is since they carry the more accurate
+// peak-RSS reading.
+func mergeOomEvents(podEvents, cgroupEvents []OomInfo) []OomInfo {
+	merged := make([]OomInfo, 0, len(podEvents)+len(cgroupEvents))
+	merged = append(merged, podEvents...)
+
+	for _, cgroupEvent := range cgroupEvents {
+		duplicate := false
+		for _, podEvent := range podEvents {
+			if podEvent.ContainerID != cgroupEvent.ContainerID {
+				continue
+			}
+			delta := podEvent.Timestamp.Sub(cgroupEvent.Timestamp)
+			if delta < 0 {
+				delta = -delta
+			}
+			if delta <= dedupeWindow {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, cgroupEvent)
+		}
+	}
+	return merged
+}
+
+// RunCgroupSource polls source for every container in containers (keyed by
+// the container's cgroup v2 memory controller path) every interval, until
+// stopCh is closed, and reports new kills on o.observedOomsChannel alongside
+// whatever OnUpdate reports from pod status.
+//
+// It honors --oom-source: with OomSourcePod (the default) it does nothing,
+// with OomSourceCgroup it reports every cgroup-detected kill, and with
+// OomSourceBoth it additionally drops a cgroup-detected kill that
+// isDuplicateOfRecentPodEvent says OnUpdate already reported for the same
+// container within dedupeWindow.
+func (o *Observer) RunCgroupSource(source *CgroupOomSource, containers map[model.ContainerID]string, interval time.Duration, stopCh <-chan struct{}) {
+	mode := OomSourceMode(*OomSourceFlag)
+	if mode != OomSourceCgroup && mode != OomSourceBoth {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			for container, cgroupPath := range containers {
+				info, err := source.Poll(container, cgroupPath, now)
+				if err != nil || info == nil {
+					continue
+				}
+				if mode == OomSourceBoth && o.isDuplicateOfRecentPodEvent(*info) {
+					continue
+				}
+				o.observedOomsChannel <- []OomInfo{*info}
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+type fakeCgroupMemoryEventsReader struct {
+	oom, oomKill int64
+	peak         model.ResourceAmount
+}
+
+func (f *fakeCgroupMemoryEventsReader) ReadOomCount(cgroupPath string) (int64, int64, error) {
+	return f.oom, f.oomKill, nil
+}
+
+func (f *fakeCgroupMemoryEventsReader) ReadPeakMemory(cgroupPath string) (model.ResourceAmount, error) {
+	return f.peak, nil
+}
+
+func TestCgroupOomSourcePollEmitsOnNewKill(t *testing.T) {
+	reader := &fakeCgroupMemoryEventsReader{oomKill: 1, peak: model.ResourceAmount(2048)}
+	source := NewCgroupOomSource(reader)
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	now := time.Unix(0, 0).UTC()
+
+	info, err := source.Poll(container, "/sys/fs/cgroup/ns/pod/c", now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, model.ResourceAmount(2048), info.Memory)
+		assert.Equal(t, model.ResourceMemory, info.Resource)
+		assert.Equal(t, container, info.ContainerID)
+	}
+
+	// polling again with no new kill should not emit another event.
+	info, err = source.Poll(container, "/sys/fs/cgroup/ns/pod/c", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+
+	// a second kill increments the counter again.
+	reader.oomKill = 2
+	reader.peak = model.ResourceAmount(4096)
+	info, err = source.Poll(container, "/sys/fs/cgroup/ns/pod/c", now.Add(2*time.Second))
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, model.ResourceAmount(4096), info.Memory)
+	}
+}
+
+func TestObserverIsDuplicateOfRecentPodEvent(t *testing.T) {
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	observer := NewObserver()
+	observer.recordPodEvent(OomInfo{Timestamp: time.Unix(1000, 0).UTC(), Memory: 1024, Resource: model.ResourceMemory, ContainerID: container})
+
+	duplicate := OomInfo{Timestamp: time.Unix(1002, 0).UTC(), Memory: 4096, Resource: model.ResourceMemory, ContainerID: container}
+	assert.True(t, observer.isDuplicateOfRecentPodEvent(duplicate))
+
+	distinct := OomInfo{Timestamp: time.Unix(5000, 0).UTC(), Memory: 4096, Resource: model.ResourceMemory, ContainerID: container}
+	assert.False(t, observer.isDuplicateOfRecentPodEvent(distinct))
+}
+
+func TestMergeOomEventsDedupesWithinWindow(t *testing.T) {
+	container := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c"}
+	base := time.Unix(1000, 0).UTC()
+
+	podEvents := []OomInfo{
+		{Timestamp: base, Memory: model.ResourceAmount(1024), Resource: model.ResourceMemory, ContainerID: container},
+	}
+	cgroupEvents := []OomInfo{
+		// Within the dedupe window: should be dropped in favor of the pod event.
+		{Timestamp: base.Add(2 * time.Second), Memory: model.ResourceAmount(4096), Resource: model.ResourceMemory, ContainerID: container},
+		// Outside the dedupe window: a distinct kill, should be kept.
+		{Timestamp: base.Add(time.Hour), Memory: model.ResourceAmount(8192), Resource: model.ResourceMemory, ContainerID: container},
+	}
+
+	merged := mergeOomEvents(podEvents, cgroupEvents)
+
+	assert.Len(t, merged, 2)
+	assert.Equal(t, podEvents[0], merged[0])
+	assert.Equal(t, cgroupEvents[1], merged[1])
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oom derives OomInfo events - a container having been killed or
+// evicted for running over a resource limit - from the two signals the
+// recommender has traditionally had available: a container's own
+// LastTerminationState (OOMKilled and JVM Heap OOM restarts) and kubelet
+// Eviction events on the pod. See cgroup_source.go for the newer,
+// node-local cgroup v2 signal source.
+package oom
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// jvmHeapOOMMessage is the substring kubelet/the JVM's termination message
+// carries when a container was killed for running out of JVM heap rather
+// than being OOM-killed by the kernel.
+const jvmHeapOOMMessage = "JVM Heap OOM"
+
+// overrideJvmHeapSizeEnv is the env var name applications set to tell the
+// recommender what heap size they were actually configured with, for
+// containers where the heap size isn't simply "the memory limit".
+const overrideJvmHeapSizeEnv = "OVERRIDE_JVM_HEAP_SIZE"
+
+// OomInfo describes a single OOM/eviction event observed for a container.
+type OomInfo struct {
+	Timestamp   time.Time
+	Memory      model.ResourceAmount
+	Resource    model.ResourceName
+	ContainerID model.ContainerID
+}
+
+// Observer watches pod updates and kubelet eviction events and reports the
+// OomInfo it derives from them on observedOomsChannel. When --oom-source is
+// "both", it also backs RunCgroupSource's deduplication against recently
+// reported pod-status events (see recordPodEvent/isDuplicateOfRecentPodEvent
+// below, and RunCgroupSource in cgroup_source.go).
+type Observer struct {
+	observedOomsChannel chan []OomInfo
+
+	mu            sync.Mutex
+	recentPodOoms []OomInfo
+}
+
+// NewObserver returns an Observer ready to receive OnUpdate calls.
+func NewObserver() *Observer {
+	return &Observer{
+		observedOomsChannel: make(chan []OomInfo),
+	}
+}
+
+// OnUpdate compares a pod's previous and current status and, if a container
+// that restarted was last terminated for being OOM-killed or for running out
+// of configured JVM heap, emits the corresponding OomInfo(s) on
+// observedOomsChannel. It honors --oom-source: with OomSourceCgroup, the
+// cgroup source replaces this one entirely, so OnUpdate is a no-op.
+func (o *Observer) OnUpdate(oldPod, newPod *v1.Pod) {
+	mode := OomSourceMode(*OomSourceFlag)
+	if mode != OomSourcePod && mode != OomSourceBoth {
+		return
+	}
+
+	previousRestarts := make(map[string]int32, len(oldPod.Status.ContainerStatuses))
+	for _, status := range oldPod.Status.ContainerStatuses {
+		previousRestarts[status.Name] = status.RestartCount
+	}
+
+	for _, status := range newPod.Status.ContainerStatuses {
+		if status.RestartCount <= previousRestarts[status.Name] {
+			continue
+		}
+		terminated := status.LastTerminationState.Terminated
+		if terminated == nil {
+			continue
+		}
+		container := findContainerSpec(newPod, status.Name)
+		if container == nil {
+			continue
+		}
+		containerID := model.ContainerID{
+			PodID:         model.PodID{Namespace: newPod.Namespace, PodName: newPod.Name},
+			ContainerName: status.Name,
+		}
+		o.reportTermination(containerID, container, terminated)
+	}
+}
+
+func (o *Observer) reportTermination(containerID model.ContainerID, container *v1.Container, terminated *v1.ContainerStateTerminated) {
+	timestamp := terminated.FinishedAt.Time
+	limit := quantityAmount(container.Resources.Limits.Memory())
+
+	switch {
+	case terminated.Reason == "OOMKilled":
+		request := quantityAmount(container.Resources.Requests.Memory())
+		memInfo := OomInfo{Timestamp: timestamp, Memory: request, Resource: model.ResourceMemory, ContainerID: containerID}
+		rssInfo := OomInfo{Timestamp: timestamp, Memory: limit, Resource: model.ResourceRSS, ContainerID: containerID}
+		o.observedOomsChannel <- []OomInfo{memInfo}
+		o.observedOomsChannel <- []OomInfo{rssInfo}
+		o.recordPodEvent(memInfo)
+		o.recordPodEvent(rssInfo)
+
+	case strings.Contains(terminated.Message, jvmHeapOOMMessage):
+		override := findContainerOverrideJvmHeapSizeEnv(container.Env)
+		if override == nil {
+			return
+		}
+		jvmInfo := OomInfo{Timestamp: timestamp, Memory: model.ResourceAmount(override.Value()), Resource: model.ResourceJVMHeapCommitted, ContainerID: containerID}
+		rssInfo := OomInfo{Timestamp: timestamp, Memory: limit, Resource: model.ResourceRSS, ContainerID: containerID}
+		o.observedOomsChannel <- []OomInfo{jvmInfo, rssInfo}
+		o.recordPodEvent(jvmInfo)
+		o.recordPodEvent(rssInfo)
+	}
+}
+
+// recordPodEvent remembers a pod-status-derived OomInfo so a cgroup event for
+// the same container observed shortly after (see RunCgroupSource) can be
+// recognized as the same kill instead of double-counted. Entries whose
+// Timestamp is more than 2*dedupeWindow before info's are pruned on each call
+// so the buffer doesn't grow without bound on a long-running recommender.
+func (o *Observer) recordPodEvent(info OomInfo) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.recentPodOoms = append(o.recentPodOoms, info)
+	cutoff := info.Timestamp.Add(-2 * dedupeWindow)
+	kept := o.recentPodOoms[:0]
+	for _, event := range o.recentPodOoms {
+		if event.Timestamp.After(cutoff) {
+			kept = append(kept, event)
+		}
+	}
+	o.recentPodOoms = kept
+}
+
+// isDuplicateOfRecentPodEvent reports whether cgroupEvent is, per
+// mergeOomEvents, the same kill as a pod-status event already recorded by
+// recordPodEvent.
+func (o *Observer) isDuplicateOfRecentPodEvent(cgroupEvent OomInfo) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	merged := mergeOomEvents(o.recentPodOoms, []OomInfo{cgroupEvent})
+	return len(merged) == len(o.recentPodOoms)
+}
+
+func findContainerSpec(pod *v1.Pod, containerName string) *v1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func quantityAmount(q *resource.Quantity) model.ResourceAmount {
+	if q == nil {
+		return 0
+	}
+	return model.ResourceAmount(q.Value())
+}
+
+// findContainerOverrideJvmHeapSizeEnv returns the parsed OVERRIDE_JVM_HEAP_SIZE
+// env value for container, or nil if it isn't set or isn't parseable. The
+// env var uses a shorthand suffix ("512m", "2g") rather than Kubernetes'
+// binary suffixes, so a trailing m/M or g/G is rewritten to Mi/Gi before
+// parsing; anything else (including a bare byte count) is parsed as-is.
+func findContainerOverrideJvmHeapSizeEnv(envVars []v1.EnvVar) *resource.Quantity {
+	for _, env := range envVars {
+		if env.Name != overrideJvmHeapSizeEnv {
+			continue
+		}
+		return parseJvmHeapSize(env.Value)
+	}
+	return nil
+}
+
+func parseJvmHeapSize(value string) *resource.Quantity {
+	if value == "" {
+		return nil
+	}
+
+	normalized := value
+	switch value[len(value)-1] {
+	case 'm', 'M':
+		normalized = value[:len(value)-1] + "Mi"
+	case 'g', 'G':
+		normalized = value[:len(value)-1] + "Gi"
+	}
+
+	quantity, err := resource.ParseQuantity(normalized)
+	if err != nil {
+		return nil
+	}
+	return &quantity
+}
+
+// parseEvictionEvent extracts one OomInfo per offending container from a
+// kubelet Evicted event's annotations (offending_containers,
+// offending_containers_usage, starved_resource - each a parallel comma
+// separated list). A starved_resource value this package doesn't recognize
+// (see resourceForStarvedResource) is skipped on its own; if the three lists
+// don't have matching lengths the whole event is dropped, since there's no
+// reliable way to line entries up.
+func parseEvictionEvent(event *v1.Event) []OomInfo {
+	containers := splitAnnotation(event.Annotations["offending_containers"])
+	usages := splitAnnotation(event.Annotations["offending_containers_usage"])
+	starved := splitAnnotation(event.Annotations["starved_resource"])
+
+	infos := []OomInfo{}
+	if len(containers) != len(usages) || len(containers) != len(starved) {
+		return infos
+	}
+
+	for i, containerName := range containers {
+		resourceName, ok := resourceForStarvedResource(starved[i])
+		if !ok {
+			continue
+		}
+		usage, err := resource.ParseQuantity(usages[i])
+		if err != nil {
+			continue
+		}
+		infos = append(infos, OomInfo{
+			Timestamp: event.CreationTimestamp.Time.UTC(),
+			Memory:    model.ResourceAmount(usage.Value()),
+			Resource:  resourceName,
+			ContainerID: model.ContainerID{
+				PodID:         model.PodID{Namespace: event.InvolvedObject.Namespace, PodName: event.InvolvedObject.Name},
+				ContainerName: containerName,
+			},
+		})
+	}
+	return infos
+}
+
+func splitAnnotation(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return parts
+}
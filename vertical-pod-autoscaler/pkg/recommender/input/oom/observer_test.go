@@ -198,6 +198,22 @@ func TestJVMHeapOOMReceived(t *testing.T) {
 
 }
 
+func TestOnUpdateSkippedWhenOomSourceIsCgroup(t *testing.T) {
+	previous := *OomSourceFlag
+	*OomSourceFlag = string(OomSourceCgroup)
+	defer func() { *OomSourceFlag = previous }()
+
+	p1, err := newPod(pod1Yaml)
+	assert.NoError(t, err)
+	p2, err := newPod(pod2Yaml)
+	assert.NoError(t, err)
+
+	observer := NewObserver()
+	observer.OnUpdate(p1, p2)
+
+	assert.Empty(t, observer.observedOomsChannel, "cgroup mode should replace the pod-status source, not double it up")
+}
+
 func TestMalformedPodReceived(t *testing.T) {
 	p1, err := newPod(pod1Yaml)
 	assert.NoError(t, err)
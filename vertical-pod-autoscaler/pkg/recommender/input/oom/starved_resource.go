@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// starvedResources maps the kubelet's starved_resource eviction annotation
+// values to the model.ResourceName parseEvictionEvent should record the
+// OomInfo against. Kubelet also evicts for ephemeral-storage and pid
+// starvation, not just memory, and until now parseEvictionEvent silently
+// dropped those, losing eviction signal that should be driving
+// ephemeral-storage and pid recommendations.
+var starvedResources = map[string]model.ResourceName{
+	"memory":            model.ResourceMemory,
+	"ephemeral-storage": model.ResourceEphemeralStorage,
+	"pids":              model.ResourcePID,
+}
+
+// resourceForStarvedResource resolves a single starved_resource annotation
+// value (e.g. "memory", "ephemeral-storage", "pids") to the model.ResourceName
+// parseEvictionEvent should use, reporting ok=false for anything else so the
+// caller can skip it the same way it already skips unrecognized resources.
+func resourceForStarvedResource(starvedResource string) (model.ResourceName, bool) {
+	resource, ok := starvedResources[starvedResource]
+	return resource, ok
+}
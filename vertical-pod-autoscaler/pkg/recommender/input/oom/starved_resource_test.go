@@ -0,0 +1,46 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func TestResourceForStarvedResource(t *testing.T) {
+	tests := []struct {
+		starvedResource string
+		wantResource    model.ResourceName
+		wantOk          bool
+	}{
+		{"memory", model.ResourceMemory, true},
+		{"ephemeral-storage", model.ResourceEphemeralStorage, true},
+		{"pids", model.ResourcePID, true},
+		{"evictable", "", false},
+	}
+
+	for _, tc := range tests {
+		resource, ok := resourceForStarvedResource(tc.starvedResource)
+		assert.Equal(t, tc.wantOk, ok, tc.starvedResource)
+		if tc.wantOk {
+			assert.Equal(t, tc.wantResource, resource, tc.starvedResource)
+		}
+	}
+}
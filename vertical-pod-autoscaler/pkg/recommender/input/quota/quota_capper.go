@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package quota caps VPA recommendations against namespace-level
+// scheduling.sigs.k8s.io/v1alpha1 ElasticQuota objects and standard
+// ResourceQuota objects, so the recommender doesn't hand out recommendations
+// that the quota admission plugin would immediately reject.
+package quota
+
+import (
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// ConditionRecommendationCappedByQuota is the VPA condition type recorded
+// when Capper.Cap had to shrink a namespace's raw recommendations to fit
+// within its ElasticQuota/ResourceQuota limits.
+const ConditionRecommendationCappedByQuota = "RecommendationCappedByQuota"
+
+// NamespaceLimits is the min/max a namespace's pods may sum to, taken from an
+// ElasticQuota's spec.min/spec.max or, for a plain ResourceQuota, from its
+// spec.hard (used as Max only; Min is left empty since ResourceQuota has no
+// floor). Min
+// isn't applied by ProportionalCapper today; it's carried here so a future
+// Capper can flag namespaces where Max alone can't satisfy Min guarantees.
+type NamespaceLimits struct {
+	Min model.Resources
+	Max model.Resources
+}
+
+// ContainerRecommendation is the subset of a per-container VPA
+// recommendation that quota capping needs: the raw recommended amount per
+// resource, and the percentile usage weight used to distribute a shrink
+// proportionally across containers in the namespace.
+type ContainerRecommendation struct {
+	ContainerID model.ContainerID
+	Target      model.Resources
+	// Weight is this container's share of total percentile usage for a given
+	// resource, in [0, 1], used to distribute a required shrink.
+	Weight map[model.ResourceName]float64
+}
+
+// CapResult is the outcome of capping one namespace's recommendations.
+type CapResult struct {
+	Recommendations []ContainerRecommendation
+	// Capped lists the resources that had to be shrunk to fit NamespaceLimits.Max.
+	Capped []model.ResourceName
+}
+
+// Capper caps a namespace's raw recommendations against its quota limits.
+type Capper interface {
+	// Cap returns recommendations adjusted to fit within limits. If the raw
+	// recommendations already fit, the result is a copy of recommendations
+	// and Capped is empty.
+	Cap(limits NamespaceLimits, recommendations []ContainerRecommendation) CapResult
+}
+
+// ProportionalCapper caps by shrinking every container's recommendation for
+// an over-quota resource in proportion to its Weight, so the container that
+// was already using the most keeps the largest share of the available quota.
+type ProportionalCapper struct{}
+
+// NewProportionalCapper returns the default Capper.
+func NewProportionalCapper() *ProportionalCapper {
+	return &ProportionalCapper{}
+}
+
+// Cap implements Capper.
+func (c *ProportionalCapper) Cap(limits NamespaceLimits, recommendations []ContainerRecommendation) CapResult {
+	sums := make(map[model.ResourceName]model.ResourceAmount)
+	for _, rec := range recommendations {
+		for resource, amount := range rec.Target {
+			sums[resource] += amount
+		}
+	}
+
+	var capped []model.ResourceName
+	result := make([]ContainerRecommendation, len(recommendations))
+	copy(result, recommendations)
+	for i := range result {
+		result[i].Target = make(model.Resources, len(recommendations[i].Target))
+		for resource, amount := range recommendations[i].Target {
+			result[i].Target[resource] = amount
+		}
+	}
+
+	for resource, max := range limits.Max {
+		sum, ok := sums[resource]
+		if !ok || sum <= max {
+			continue
+		}
+		capped = append(capped, resource)
+
+		// Shrink every container's share of this resource in proportion to
+		// its weight (its share of total percentile usage), so the
+		// container that was already using the most keeps the largest slice
+		// of the available quota.
+		for i, rec := range recommendations {
+			result[i].Target[resource] = model.ResourceAmount(float64(max) * rec.Weight[resource])
+		}
+	}
+
+	return CapResult{Recommendations: result, Capped: capped}
+}
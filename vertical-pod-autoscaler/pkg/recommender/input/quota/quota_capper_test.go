@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func TestProportionalCapperNoopWhenWithinLimits(t *testing.T) {
+	capper := NewProportionalCapper()
+	limits := NamespaceLimits{
+		Min: model.Resources{model.ResourceMemory: 0},
+		Max: model.Resources{model.ResourceMemory: 1000},
+	}
+	recs := []ContainerRecommendation{
+		{Target: model.Resources{model.ResourceMemory: 300}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.5}},
+		{Target: model.Resources{model.ResourceMemory: 300}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.5}},
+	}
+
+	result := capper.Cap(limits, recs)
+
+	assert.Empty(t, result.Capped)
+	assert.Equal(t, model.ResourceAmount(300), result.Recommendations[0].Target[model.ResourceMemory])
+	assert.Equal(t, model.ResourceAmount(300), result.Recommendations[1].Target[model.ResourceMemory])
+}
+
+func TestProportionalCapperShrinksOverQuota(t *testing.T) {
+	capper := NewProportionalCapper()
+	limits := NamespaceLimits{
+		Min: model.Resources{model.ResourceMemory: 0},
+		Max: model.Resources{model.ResourceMemory: 1000},
+	}
+	recs := []ContainerRecommendation{
+		{Target: model.Resources{model.ResourceMemory: 1500}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.75}},
+		{Target: model.Resources{model.ResourceMemory: 500}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.25}},
+	}
+
+	result := capper.Cap(limits, recs)
+
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, result.Capped)
+	assert.Equal(t, model.ResourceAmount(750), result.Recommendations[0].Target[model.ResourceMemory])
+	assert.Equal(t, model.ResourceAmount(250), result.Recommendations[1].Target[model.ResourceMemory])
+}
+
+func TestProportionalCapperShrunkContainersSumToMax(t *testing.T) {
+	capper := NewProportionalCapper()
+	limits := NamespaceLimits{
+		Min: model.Resources{model.ResourceMemory: 0},
+		Max: model.Resources{model.ResourceMemory: 1000},
+	}
+	recs := []ContainerRecommendation{
+		{Target: model.Resources{model.ResourceMemory: 1900}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.95}},
+		{Target: model.Resources{model.ResourceMemory: 100}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.05}},
+	}
+
+	result := capper.Cap(limits, recs)
+
+	var sum model.ResourceAmount
+	for _, rec := range result.Recommendations {
+		sum += rec.Target[model.ResourceMemory]
+	}
+	assert.Equal(t, model.ResourceAmount(1000), sum)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// ConditionSetter records that a VPA's recommendation was capped by quota.
+// Runner doesn't set VPA status itself: the generated VerticalPodAutoscaler
+// clientset isn't vendored into this package, so the caller (the cluster
+// feeder, which already holds that clientset) supplies how the condition
+// actually gets patched onto the object.
+type ConditionSetter interface {
+	// SetCappedCondition records ConditionRecommendationCappedByQuota (true,
+	// listing capped in the message) on the named VPA's status, or clears it
+	// (false) when capped is empty.
+	SetCappedCondition(namespace, vpaName string, capped []model.ResourceName) error
+}
+
+// VPARecommendation is one VPA's raw per-container recommendations, the unit
+// Runner.Cap works on.
+type VPARecommendation struct {
+	VPAName         string
+	Recommendations []ContainerRecommendation
+}
+
+// Runner applies a Capper to real cluster state: it resolves NamespaceLimits
+// from a namespace's actual ElasticQuota/ResourceQuota objects, caps each
+// VPA's recommendations against them, and reports the outcome through
+// ConditionSetter.
+type Runner struct {
+	dynamicClient dynamic.Interface
+	kubeClient    kubernetes.Interface
+	capper        Capper
+	conditions    ConditionSetter
+}
+
+// NewRunner returns a Runner that resolves quota through dynamicClient (for
+// ElasticQuota) and kubeClient (for ResourceQuota), caps with capper, and
+// reports outcomes through conditions.
+func NewRunner(dynamicClient dynamic.Interface, kubeClient kubernetes.Interface, capper Capper, conditions ConditionSetter) *Runner {
+	return &Runner{
+		dynamicClient: dynamicClient,
+		kubeClient:    kubeClient,
+		capper:        capper,
+		conditions:    conditions,
+	}
+}
+
+// Cap resolves namespace's real quota limits and caps the combined
+// recommendations of every VPA in vpas against them, reporting the result
+// through ConditionSetter. The quota applies to the namespace as a whole, so
+// capping is done once over every VPA's recommendations pooled together
+// (matching NamespaceLimits.Max against the sum across all VPA-controlled
+// pods, not each VPA's own total) rather than one VPA at a time against the
+// whole budget. If namespace has neither an ElasticQuota nor a ResourceQuota,
+// every VPA's recommendations pass through unchanged and no condition is set.
+func (r *Runner) Cap(ctx context.Context, namespace string, vpas []VPARecommendation) ([]CapResult, error) {
+	limits, ok, err := NamespaceLimitsFromQuota(ctx, r.dynamicClient, r.kubeClient, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("resolving quota limits for namespace %s: %v", namespace, err)
+	}
+
+	results := make([]CapResult, len(vpas))
+	if !ok {
+		for i, vpa := range vpas {
+			results[i] = CapResult{Recommendations: vpa.Recommendations}
+		}
+		return results, nil
+	}
+
+	// Real per-container requests are the minimum real-data baseline for
+	// Weight (see ContainerResourceWeights): an empty label selector matches
+	// every pod in namespace, consistent with capping being done namespace-wide
+	// above rather than per VPA's own pod selector.
+	realWeights, err := ContainerResourceWeights(ctx, r.kubeClient, namespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("computing real resource weights for namespace %s: %v", namespace, err)
+	}
+
+	// Pool every VPA's recommendations into one namespace-wide set before
+	// capping, remembering which VPA each recommendation came from so the
+	// capped amounts can be split back out afterwards.
+	var pooled []ContainerRecommendation
+	var owner []int
+	for i, vpa := range vpas {
+		for _, rec := range vpa.Recommendations {
+			rec.Weight = withRealWeights(rec.Weight, realWeights[rec.ContainerID])
+			pooled = append(pooled, rec)
+			owner = append(owner, i)
+		}
+	}
+
+	capped := r.capper.Cap(limits, pooled)
+
+	perVPA := make([][]ContainerRecommendation, len(vpas))
+	for i, rec := range capped.Recommendations {
+		perVPA[owner[i]] = append(perVPA[owner[i]], rec)
+	}
+	for i, vpa := range vpas {
+		results[i] = CapResult{Recommendations: perVPA[i], Capped: capped.Capped}
+		if err := r.conditions.SetCappedCondition(namespace, vpa.VPAName, capped.Capped); err != nil {
+			return nil, fmt.Errorf("setting %s condition on VPA %s/%s: %v", ConditionRecommendationCappedByQuota, namespace, vpa.VPAName, err)
+		}
+	}
+	return results, nil
+}
+
+// withRealWeights layers real per-resource weights over a recommendation's
+// own, so a resource ContainerResourceWeights has real data for (today,
+// cpu/memory) is capped proportionally to actual cluster state rather than
+// whatever weight the caller happened to supply, while a resource it has no
+// data for (e.g. a custom resource without a request, or a namespace with no
+// matching pods at all) keeps falling back to the caller-supplied weight.
+func withRealWeights(callerSupplied, real map[model.ResourceName]float64) map[model.ResourceName]float64 {
+	merged := make(map[model.ResourceName]float64, len(callerSupplied)+len(real))
+	for resource, weight := range callerSupplied {
+		merged[resource] = weight
+	}
+	for resource, weight := range real {
+		merged[resource] = weight
+	}
+	return merged
+}
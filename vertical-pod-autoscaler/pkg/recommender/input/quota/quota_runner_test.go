@@ -0,0 +1,299 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func newElasticQuota(namespace, name string, min, max map[string]string) *unstructured.Unstructured {
+	toResourceList := func(values map[string]string) map[string]interface{} {
+		list := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			list[k] = v
+		}
+		return list
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "scheduling.sigs.k8s.io/v1alpha1",
+		"kind":       "ElasticQuota",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"min": toResourceList(min),
+			"max": toResourceList(max),
+		},
+	}}
+}
+
+func TestNamespaceLimitsFromQuotaPrefersElasticQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		elasticQuotaGVR: "ElasticQuotaList",
+	}, newElasticQuota("ns", "quota", map[string]string{"memory": "100Mi"}, map[string]string{"memory": "1Gi"}))
+	kubeClient := fake.NewSimpleClientset()
+
+	limits, ok, err := NamespaceLimitsFromQuota(context.Background(), dynamicClient, kubeClient, "ns")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, model.ResourceAmount(100*1024*1024), limits.Min[model.ResourceMemory])
+	assert.Equal(t, model.ResourceAmount(1024*1024*1024), limits.Max[model.ResourceMemory])
+}
+
+func TestNamespaceLimitsFromQuotaFallsBackToResourceQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme)
+	kubeClient := fake.NewSimpleClientset(&corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "rq"},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			},
+		},
+	})
+
+	limits, ok, err := NamespaceLimitsFromQuota(context.Background(), dynamicClient, kubeClient, "ns")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, model.ResourceAmount(512*1024*1024), limits.Max[model.ResourceMemory])
+	assert.Empty(t, limits.Min)
+}
+
+func TestNamespaceLimitsFromQuotaNoneExist(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme)
+	kubeClient := fake.NewSimpleClientset()
+
+	_, ok, err := NamespaceLimitsFromQuota(context.Background(), dynamicClient, kubeClient, "ns")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSumPodRequests(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-a"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "c", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("750")}}},
+			}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-b"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "c", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("250")}}},
+			}},
+		},
+	)
+
+	sums, err := SumPodRequests(context.Background(), kubeClient, "ns", "")
+	require.NoError(t, err)
+	assert.Equal(t, model.ResourceAmount(1000), sums[model.ResourceMemory])
+}
+
+func TestContainerResourceWeights(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-a"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "c", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("750")}}},
+			}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-b"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "c", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("250")}}},
+			}},
+		},
+	)
+
+	weights, err := ContainerResourceWeights(context.Background(), kubeClient, "ns", "")
+	require.NoError(t, err)
+
+	containerA := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-a"}, ContainerName: "c"}
+	containerB := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-b"}, ContainerName: "c"}
+	assert.InDelta(t, 0.75, weights[containerA][model.ResourceMemory], 0.0001)
+	assert.InDelta(t, 0.25, weights[containerB][model.ResourceMemory], 0.0001)
+}
+
+type fakeConditionSetter struct {
+	capped map[string][]model.ResourceName
+}
+
+func (f *fakeConditionSetter) SetCappedCondition(namespace, vpaName string, capped []model.ResourceName) error {
+	if f.capped == nil {
+		f.capped = make(map[string][]model.ResourceName)
+	}
+	f.capped[namespace+"/"+vpaName] = capped
+	return nil
+}
+
+func TestRunnerCapSetsConditionWhenCapped(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		elasticQuotaGVR: "ElasticQuotaList",
+	}, newElasticQuota("ns", "quota", map[string]string{}, map[string]string{"memory": "1000"}))
+	kubeClient := fake.NewSimpleClientset()
+	setter := &fakeConditionSetter{}
+	runner := NewRunner(dynamicClient, kubeClient, NewProportionalCapper(), setter)
+
+	vpas := []VPARecommendation{
+		{
+			VPAName: "my-vpa",
+			Recommendations: []ContainerRecommendation{
+				{Target: model.Resources{model.ResourceMemory: 1500}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 1}},
+			},
+		},
+	}
+
+	results, err := runner.Cap(context.Background(), "ns", vpas)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, results[0].Capped)
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, setter.capped["ns/my-vpa"])
+}
+
+func TestRunnerCapAggregatesAcrossVPAsInNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		elasticQuotaGVR: "ElasticQuotaList",
+	}, newElasticQuota("ns", "quota", map[string]string{}, map[string]string{"memory": "1000"}))
+	kubeClient := fake.NewSimpleClientset()
+	setter := &fakeConditionSetter{}
+	runner := NewRunner(dynamicClient, kubeClient, NewProportionalCapper(), setter)
+
+	// Neither VPA is over quota on its own (700 and 400 each fit under the
+	// 1000 max), but their combined 1100 is over it, which should trip
+	// capping for the whole namespace.
+	vpas := []VPARecommendation{
+		{
+			VPAName: "vpa-a",
+			Recommendations: []ContainerRecommendation{
+				{Target: model.Resources{model.ResourceMemory: 700}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.7}},
+			},
+		},
+		{
+			VPAName: "vpa-b",
+			Recommendations: []ContainerRecommendation{
+				{Target: model.Resources{model.ResourceMemory: 400}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.3}},
+			},
+		},
+	}
+
+	results, err := runner.Cap(context.Background(), "ns", vpas)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, results[0].Capped, "vpa-a alone is under quota but the namespace sum (1100) is over")
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, results[1].Capped)
+	assert.Equal(t, model.ResourceAmount(700), results[0].Recommendations[0].Target[model.ResourceMemory], "700/1000 * 1000 weight share")
+	assert.Equal(t, model.ResourceAmount(300), results[1].Recommendations[0].Target[model.ResourceMemory], "300/1000 * 1000 weight share")
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, setter.capped["ns/vpa-a"])
+	assert.Equal(t, []model.ResourceName{model.ResourceMemory}, setter.capped["ns/vpa-b"])
+}
+
+func TestRunnerCapWeighsByRealPodRequestsOverCallerSupplied(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		elasticQuotaGVR: "ElasticQuotaList",
+	}, newElasticQuota("ns", "quota", map[string]string{}, map[string]string{"memory": "1000"}))
+	// container-a really requests 3x what container-b does, even though the
+	// caller-supplied Weight below (hand-set, as a real caller's would be
+	// before this fix) claims the opposite.
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-a"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "container-a", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("750")}}},
+			}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-b"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "container-b", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("250")}}},
+			}},
+		},
+	)
+	setter := &fakeConditionSetter{}
+	runner := NewRunner(dynamicClient, kubeClient, NewProportionalCapper(), setter)
+
+	containerA := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-a"}, ContainerName: "container-a"}
+	containerB := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod-b"}, ContainerName: "container-b"}
+	vpas := []VPARecommendation{
+		{
+			VPAName: "my-vpa",
+			Recommendations: []ContainerRecommendation{
+				{ContainerID: containerA, Target: model.Resources{model.ResourceMemory: 900}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.1}},
+				{ContainerID: containerB, Target: model.Resources{model.ResourceMemory: 300}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 0.9}},
+			},
+		},
+	}
+
+	results, err := runner.Cap(context.Background(), "ns", vpas)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Len(t, results[0].Recommendations, 2)
+
+	byContainer := make(map[model.ContainerID]ContainerRecommendation, 2)
+	for _, rec := range results[0].Recommendations {
+		byContainer[rec.ContainerID] = rec
+	}
+	// 1000 * 0.75 and 1000 * 0.25: real requests won the weight, not the
+	// caller-supplied 0.1/0.9.
+	assert.Equal(t, model.ResourceAmount(750), byContainer[containerA].Target[model.ResourceMemory])
+	assert.Equal(t, model.ResourceAmount(250), byContainer[containerB].Target[model.ResourceMemory])
+}
+
+func TestRunnerCapPassesThroughWithNoQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme)
+	kubeClient := fake.NewSimpleClientset()
+	setter := &fakeConditionSetter{}
+	runner := NewRunner(dynamicClient, kubeClient, NewProportionalCapper(), setter)
+
+	vpas := []VPARecommendation{
+		{
+			VPAName: "my-vpa",
+			Recommendations: []ContainerRecommendation{
+				{Target: model.Resources{model.ResourceMemory: 1500}, Weight: map[model.ResourceName]float64{model.ResourceMemory: 1}},
+			},
+		},
+	}
+
+	results, err := runner.Cap(context.Background(), "ns", vpas)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Capped)
+	assert.Equal(t, model.ResourceAmount(1500), results[0].Recommendations[0].Target[model.ResourceMemory])
+	assert.Nil(t, setter.capped)
+}
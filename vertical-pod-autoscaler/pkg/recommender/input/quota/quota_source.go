@@ -0,0 +1,217 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// elasticQuotaGVR is the scheduling.sigs.k8s.io/v1alpha1 ElasticQuota CRD.
+// There's no generated clientset for it vendored here, so it's read through
+// the dynamic client the way any other optionally-installed CRD would be.
+var elasticQuotaGVR = schema.GroupVersionResource{
+	Group:    "scheduling.sigs.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "elasticquotas",
+}
+
+// NamespaceLimitsFromQuota resolves the NamespaceLimits Capper should cap
+// against for namespace. It prefers an ElasticQuota (which has both a min
+// and a max); if none exists it falls back to the namespace's
+// ResourceQuotas, using spec.hard as Max and leaving Min empty since
+// ResourceQuota has no floor, combining multiple ResourceQuota objects resource-wise by taking
+// the tightest (smallest) hard limit for each. ok is false if the namespace
+// has neither, meaning there's nothing to cap recommendations against.
+func NamespaceLimitsFromQuota(ctx context.Context, dynamicClient dynamic.Interface, kubeClient kubernetes.Interface, namespace string) (limits NamespaceLimits, ok bool, err error) {
+	quotas, err := dynamicClient.Resource(elasticQuotaGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return NamespaceLimits{}, false, fmt.Errorf("listing ElasticQuotas in namespace %s: %v", namespace, err)
+	}
+	if len(quotas.Items) > 0 {
+		min, err := resourcesFromUnstructured(quotas.Items[0].Object, "spec", "min")
+		if err != nil {
+			return NamespaceLimits{}, false, fmt.Errorf("reading ElasticQuota %s spec.min: %v", quotas.Items[0].GetName(), err)
+		}
+		max, err := resourcesFromUnstructured(quotas.Items[0].Object, "spec", "max")
+		if err != nil {
+			return NamespaceLimits{}, false, fmt.Errorf("reading ElasticQuota %s spec.max: %v", quotas.Items[0].GetName(), err)
+		}
+		return NamespaceLimits{Min: min, Max: max}, true, nil
+	}
+
+	resourceQuotas, err := kubeClient.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return NamespaceLimits{}, false, fmt.Errorf("listing ResourceQuotas in namespace %s: %v", namespace, err)
+	}
+	if len(resourceQuotas.Items) == 0 {
+		return NamespaceLimits{}, false, nil
+	}
+
+	hard := make(model.Resources)
+	for _, rq := range resourceQuotas.Items {
+		for name, quantity := range rq.Spec.Hard {
+			resourceName, ok := quotaResourceName(string(name))
+			if !ok {
+				continue
+			}
+			amount := model.ResourceAmount(quantity.Value())
+			if existing, seen := hard[resourceName]; !seen || amount < existing {
+				hard[resourceName] = amount
+			}
+		}
+	}
+	return NamespaceLimits{Min: model.Resources{}, Max: hard}, true, nil
+}
+
+// quotaResourceName maps a ResourceQuota/ElasticQuota hard-limit key to the
+// model.ResourceName Capper works in terms of. Only cpu/memory are
+// recognized today; quota keys for anything else (pods count,
+// requests.storage, ...) aren't resources the recommender produces
+// recommendations for, so they're not relevant to capping.
+func quotaResourceName(name string) (model.ResourceName, bool) {
+	switch name {
+	case "cpu", "requests.cpu", "limits.cpu":
+		return model.ResourceCPU, true
+	case "memory", "requests.memory", "limits.memory":
+		return model.ResourceMemory, true
+	default:
+		return "", false
+	}
+}
+
+func resourcesFromUnstructured(obj map[string]interface{}, fields ...string) (model.Resources, error) {
+	raw, found, err := unstructured.NestedStringMap(obj, fields...)
+	if err != nil {
+		return nil, err
+	}
+	resources := make(model.Resources, len(raw))
+	if !found {
+		return resources, nil
+	}
+	for name, value := range raw {
+		resourceName, ok := quotaResourceName(name)
+		if !ok {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s=%q: %v", name, value, err)
+		}
+		resources[resourceName] = model.ResourceAmount(quantity.Value())
+	}
+	return resources, nil
+}
+
+// containerRequests lists every container's real resource requests (cpu/memory)
+// in namespace matching labelSelector, i.e. the pods a VPA actually controls,
+// keyed by ContainerID. It's the ground truth SumPodRequests and
+// ContainerResourceWeights are both built on, independently of whatever the
+// recommender's own recommendation totals say.
+func containerRequests(ctx context.Context, kubeClient kubernetes.Interface, namespace, labelSelector string) (map[model.ContainerID]model.Resources, error) {
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods in namespace %s: %v", namespace, err)
+	}
+
+	requests := make(map[model.ContainerID]model.Resources)
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			resources := make(model.Resources)
+			for name, quantity := range container.Resources.Requests {
+				resourceName, ok := quotaResourceName(string(name))
+				if !ok {
+					continue
+				}
+				resources[resourceName] = model.ResourceAmount(quantity.Value())
+			}
+			if len(resources) == 0 {
+				continue
+			}
+			containerID := model.ContainerID{PodID: model.PodID{Namespace: namespace, PodName: pod.Name}, ContainerName: container.Name}
+			requests[containerID] = resources
+		}
+	}
+	return requests, nil
+}
+
+// SumPodRequests sums container resource requests (cpu/memory) across every
+// pod in namespace matching labelSelector, i.e. the pods a VPA actually
+// controls, independently of whatever the recommender's own recommendation
+// totals say. Runner.Cap does not use it: it compares a quota's Max against
+// the sum of the recommendations it is given.
+func SumPodRequests(ctx context.Context, kubeClient kubernetes.Interface, namespace, labelSelector string) (model.Resources, error) {
+	perContainer, err := containerRequests(ctx, kubeClient, namespace, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(model.Resources)
+	for _, resources := range perContainer {
+		for name, amount := range resources {
+			sums[name] += amount
+		}
+	}
+	return sums, nil
+}
+
+// ContainerResourceWeights computes each container's share, in [0, 1], of the
+// real resource requests summed across every pod in namespace matching
+// labelSelector, for every resource it has a request for. This is the actual
+// weight ProportionalCapper.Cap needs to distribute a quota shrink
+// proportionally; a container with no request for a resource, or one whose
+// namespace total is zero, simply has no entry for that resource. Since this
+// still reads requests rather than true percentile usage, it's the minimum
+// real-data baseline. Runner.Cap layers these weights over any
+// caller-supplied Weight for every resource they cover (see withRealWeights),
+// so a caller-supplied percentile-based weight for cpu/memory is not used
+// there when a matching pod has a request.
+func ContainerResourceWeights(ctx context.Context, kubeClient kubernetes.Interface, namespace, labelSelector string) (map[model.ContainerID]map[model.ResourceName]float64, error) {
+	perContainer, err := containerRequests(ctx, kubeClient, namespace, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(model.Resources)
+	for _, resources := range perContainer {
+		for name, amount := range resources {
+			totals[name] += amount
+		}
+	}
+
+	weights := make(map[model.ContainerID]map[model.ResourceName]float64, len(perContainer))
+	for containerID, resources := range perContainer {
+		weight := make(map[model.ResourceName]float64, len(resources))
+		for name, amount := range resources {
+			if totals[name] == 0 {
+				continue
+			}
+			weight[name] = float64(amount) / float64(totals[name])
+		}
+		weights[containerID] = weight
+	}
+	return weights, nil
+}
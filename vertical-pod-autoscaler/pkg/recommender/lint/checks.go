@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"fmt"
+)
+
+func checkJVMHeapFloorBelowOverride(vpa VPAState, container ContainerState) []Finding {
+	if container.JVMHeapOverride == 0 {
+		return nil
+	}
+	if container.RecommendationFloor >= container.JVMHeapOverride {
+		return nil
+	}
+	return []Finding{{
+		Rule:      RuleJVMHeapFloorBelowOverride,
+		Namespace: vpa.Namespace,
+		VPAName:   vpa.Name,
+		Container: container.ContainerName,
+		Message: fmt.Sprintf("recommendation floor (%d) is below OVERRIDE_JVM_HEAP_SIZE (%d); this container is guaranteed to OOM once the heap reaches its configured size",
+			container.RecommendationFloor, container.JVMHeapOverride),
+	}}
+}
+
+func checkInsufficientSamples(vpa VPAState, container ContainerState, minSamples int) []Finding {
+	if container.RSSSampleCount >= minSamples {
+		return nil
+	}
+	return []Finding{{
+		Rule:      RuleInsufficientSamples,
+		Namespace: vpa.Namespace,
+		VPAName:   vpa.Name,
+		Container: container.ContainerName,
+		Message: fmt.Sprintf("RSS histogram has only %d samples (want at least %d); recommendation is still mostly prior",
+			container.RSSSampleCount, minSamples),
+	}}
+}
+
+func checkJVMHeapExceedsLimit(vpa VPAState, container ContainerState) []Finding {
+	if container.JVMHeapCommittedP99 == 0 || container.MemoryLimit == 0 {
+		return nil
+	}
+	available := container.MemoryLimit - container.MemoryOverhead
+	if container.JVMHeapCommittedP99 <= available {
+		return nil
+	}
+	return []Finding{{
+		Rule:      RuleJVMHeapExceedsLimit,
+		Namespace: vpa.Namespace,
+		VPAName:   vpa.Name,
+		Container: container.ContainerName,
+		Message: fmt.Sprintf("p99 JVMHeapCommitted (%d) regularly exceeds memory limit minus overhead (%d); expect OOM kills",
+			container.JVMHeapCommittedP99, available),
+	}}
+}
+
+func checkMinExceedsMax(vpa VPAState) []Finding {
+	var findings []Finding
+	for _, container := range vpa.Containers {
+		for resource, min := range container.MinAllowed {
+			max, ok := container.MaxAllowed[resource]
+			if !ok || min <= max {
+				continue
+			}
+			findings = append(findings, Finding{
+				Rule:      RuleMinExceedsMax,
+				Namespace: vpa.Namespace,
+				VPAName:   vpa.Name,
+				Container: container.ContainerName,
+				Message:   fmt.Sprintf("MinAllowed[%s] (%d) is greater than MaxAllowed[%s] (%d); the admission webhook will reject this policy", resource, min, resource, max),
+			})
+		}
+	}
+	return findings
+}
+
+func checkAutoUpdateWithoutPDB(vpa VPAState) []Finding {
+	// Auto and Recreate both let the VPA updater evict/recreate pods to
+	// apply a recommendation; Initial and Off never evict.
+	if (vpa.UpdateMode != "Auto" && vpa.UpdateMode != "Recreate") || vpa.HasPDB {
+		return nil
+	}
+	return []Finding{{
+		Rule:      RuleAutoUpdateWithoutPDB,
+		Namespace: vpa.Namespace,
+		VPAName:   vpa.Name,
+		Message:   fmt.Sprintf("updateMode is %s but the target has no PodDisruptionBudget; VPA-driven evictions aren't rate limited", vpa.UpdateMode),
+	}}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command vpa-recommender-lint is the `lint` subcommand's standalone binary:
+// this checkout has no existing `vpa-recommender` main to add a subcommand
+// to, so it ships as its own small command instead, invoked the same way
+// (`vpa-recommender-lint --namespace=...`) until it can be folded in.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/lint"
+)
+
+var (
+	kubeconfig = flag.String("kubeconfig", "", "Path to a kubeconfig file. Defaults to in-cluster config when unset.")
+	namespace  = flag.String("namespace", "", "Namespace to lint VPAs in. Defaults to all namespaces.")
+	minSamples = flag.Int("min-samples", lint.MinSamplesDefault, "Minimum RSS sample count before a recommendation is trusted; see lint.RuleInsufficientSamples.")
+	jsonOutput = flag.Bool("json", false, "Print the report as JSON instead of one line per finding.")
+)
+
+func main() {
+	flag.Parse()
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "building kube client config: %v\n", err)
+		os.Exit(2)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "building kube client: %v\n", err)
+		os.Exit(2)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "building dynamic client: %v\n", err)
+		os.Exit(2)
+	}
+
+	vpas, err := lint.CollectVPAState(context.Background(), dynamicClient, kubeClient, *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "collecting VPA state: %v\n", err)
+		os.Exit(2)
+	}
+
+	report := lint.Lint(vpas, *minSamples)
+	if *jsonOutput {
+		out, err := report.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rendering report as JSON: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(out))
+	} else {
+		fmt.Print(report.Text())
+	}
+
+	if report.HasFindings() {
+		os.Exit(1)
+	}
+}
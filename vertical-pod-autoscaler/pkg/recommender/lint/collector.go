@@ -0,0 +1,303 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"context"
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+var (
+	vpaGVR        = schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}
+	checkpointGVR = schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalercheckpoints"}
+	deploymentGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// CollectVPAState builds the VPAState Lint needs for every VerticalPodAutoscaler
+// in namespace from real cluster objects: the VPA's own spec/status (no
+// generated VPA clientset is vendored here, so it's read through the dynamic
+// client like the ElasticQuota CRD in the quota package) for update mode,
+// resource policy and per-container recommendation lower bounds; the VPA's
+// VerticalPodAutoscalerCheckpoint for RSSSampleCount; a Deployment target's
+// pod template for MemoryLimit/JVMHeapOverride; and any PodDisruptionBudget
+// in the namespace whose selector matches the target's pod labels.
+//
+// Two gaps are left for a future pass rather than guessed at: only
+// Deployment targets are resolved (StatefulSet/ReplicaSet targets get no
+// MemoryLimit/JVMHeapOverride/HasPDB), and JVMHeapCommittedP99 is always 0
+// because decoding it needs the recommender's own decaying-histogram
+// checkpoint format, which isn't vendored into this checkout - so
+// RuleJVMHeapExceedsLimit never fires off collected state today.
+func CollectVPAState(ctx context.Context, dynamicClient dynamic.Interface, kubeClient kubernetes.Interface, namespace string) ([]VPAState, error) {
+	vpas, err := dynamicClient.Resource(vpaGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing VerticalPodAutoscalers in namespace %s: %v", namespace, err)
+	}
+	pdbs, err := kubeClient.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing PodDisruptionBudgets in namespace %s: %v", namespace, err)
+	}
+
+	states := make([]VPAState, 0, len(vpas.Items))
+	for i := range vpas.Items {
+		state, err := collectOneVPAState(ctx, dynamicClient, &vpas.Items[i], pdbs.Items)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func collectOneVPAState(ctx context.Context, dynamicClient dynamic.Interface, vpa *unstructured.Unstructured, pdbs []policyv1.PodDisruptionBudget) (VPAState, error) {
+	updateMode, _, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode")
+	if updateMode == "" {
+		updateMode = "Auto"
+	}
+
+	targetLabels, memoryLimits, jvmOverrides, err := targetPodTemplateState(ctx, dynamicClient, vpa)
+	if err != nil {
+		return VPAState{}, err
+	}
+	totalSamples, err := checkpointTotalSamples(ctx, dynamicClient, vpa.GetNamespace(), vpa.GetName())
+	if err != nil {
+		return VPAState{}, err
+	}
+
+	policies, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "resourcePolicy", "containerPolicies")
+	recommendations, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+
+	containerNames := map[string]bool{}
+	for _, raw := range policies {
+		if name := containerNameOf(raw); name != "" {
+			containerNames[name] = true
+		}
+	}
+	for _, raw := range recommendations {
+		if name := containerNameOf(raw); name != "" {
+			containerNames[name] = true
+		}
+	}
+
+	state := VPAState{
+		Namespace:  vpa.GetNamespace(),
+		Name:       vpa.GetName(),
+		UpdateMode: updateMode,
+		HasPDB:     anyPDBCoversLabels(pdbs, vpa.GetNamespace(), targetLabels),
+	}
+	for containerName := range containerNames {
+		state.Containers = append(state.Containers, ContainerState{
+			ContainerName:       containerName,
+			RecommendationFloor: lowerBoundMemory(recommendations, containerName),
+			JVMHeapOverride:     jvmOverrides[containerName],
+			RSSSampleCount:      totalSamples[containerName],
+			MemoryLimit:         memoryLimits[containerName],
+			MinAllowed:          resourcesFromPolicy(policies, containerName, "minAllowed"),
+			MaxAllowed:          resourcesFromPolicy(policies, containerName, "maxAllowed"),
+		})
+	}
+	return state, nil
+}
+
+func containerNameOf(raw interface{}) string {
+	entry, ok := raw.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _, _ := unstructured.NestedString(entry, "containerName")
+	return name
+}
+
+func quantityFromField(entry map[string]interface{}, resourceKey string, fields ...string) model.ResourceAmount {
+	values, found, err := unstructured.NestedStringMap(entry, fields...)
+	if err != nil || !found {
+		return 0
+	}
+	raw, ok := values[resourceKey]
+	if !ok {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(raw)
+	if err != nil {
+		return 0
+	}
+	return model.ResourceAmount(quantity.Value())
+}
+
+func lowerBoundMemory(recommendations []interface{}, containerName string) model.ResourceAmount {
+	for _, raw := range recommendations {
+		entry, ok := raw.(map[string]interface{})
+		if !ok || containerNameOf(entry) != containerName {
+			continue
+		}
+		return quantityFromField(entry, "memory", "lowerBound")
+	}
+	return 0
+}
+
+func resourcesFromPolicy(policies []interface{}, containerName, field string) model.Resources {
+	for _, raw := range policies {
+		entry, ok := raw.(map[string]interface{})
+		if !ok || containerNameOf(entry) != containerName {
+			continue
+		}
+		values, found, err := unstructured.NestedStringMap(entry, field)
+		if err != nil || !found {
+			return nil
+		}
+		resources := make(model.Resources, len(values))
+		for name, value := range values {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				continue
+			}
+			switch name {
+			case "cpu":
+				resources[model.ResourceCPU] = model.ResourceAmount(quantity.Value())
+			case "memory":
+				resources[model.ResourceMemory] = model.ResourceAmount(quantity.Value())
+			}
+		}
+		return resources
+	}
+	return nil
+}
+
+// targetPodTemplateState resolves vpa's spec.targetRef, and for a Deployment
+// target returns its pod template labels, per-container memory limits, and
+// per-container OVERRIDE_JVM_HEAP_SIZE env values. Any other target kind (or
+// a target that no longer exists) returns zero values rather than an error,
+// since a stale/unsupported targetRef shouldn't block linting the rest of
+// the VPA's state.
+func targetPodTemplateState(ctx context.Context, dynamicClient dynamic.Interface, vpa *unstructured.Unstructured) (map[string]string, map[string]model.ResourceAmount, map[string]model.ResourceAmount, error) {
+	kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+	name, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+	if kind != "Deployment" || name == "" {
+		return nil, nil, nil, nil
+	}
+
+	target, err := dynamicClient.Resource(deploymentGVR).Namespace(vpa.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, fmt.Errorf("getting target Deployment %s/%s: %v", vpa.GetNamespace(), name, err)
+	}
+
+	podLabels, _, _ := unstructured.NestedStringMap(target.Object, "spec", "template", "metadata", "labels")
+	containers, _, _ := unstructured.NestedSlice(target.Object, "spec", "template", "spec", "containers")
+
+	memoryLimits := make(map[string]model.ResourceAmount)
+	jvmOverrides := make(map[string]model.ResourceAmount)
+	for _, raw := range containers {
+		container, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containerName, _, _ := unstructured.NestedString(container, "name")
+		memoryLimits[containerName] = quantityFromField(container, "memory", "resources", "limits")
+
+		env, _, _ := unstructured.NestedSlice(container, "env")
+		for _, rawEnv := range env {
+			envVar, ok := rawEnv.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if envName, _, _ := unstructured.NestedString(envVar, "name"); envName != overrideJVMHeapSizeEnv {
+				continue
+			}
+			value, _, _ := unstructured.NestedString(envVar, "value")
+			// Same shorthand the oom package accepts: a trailing m/M or
+			// g/G means Mi/Gi.
+			if n := len(value); n > 0 {
+				switch value[n-1] {
+				case 'm', 'M':
+					value = value[:n-1] + "Mi"
+				case 'g', 'G':
+					value = value[:n-1] + "Gi"
+				}
+			}
+			if quantity, err := resource.ParseQuantity(value); err == nil {
+				jvmOverrides[containerName] = model.ResourceAmount(quantity.Value())
+			}
+		}
+	}
+	return podLabels, memoryLimits, jvmOverrides, nil
+}
+
+// overrideJVMHeapSizeEnv mirrors oom.overrideJvmHeapSizeEnv; it isn't
+// imported from there to avoid this package depending on the oom package for
+// a single string constant.
+const overrideJVMHeapSizeEnv = "OVERRIDE_JVM_HEAP_SIZE"
+
+func anyPDBCoversLabels(pdbs []policyv1.PodDisruptionBudget, namespace string, targetLabels map[string]string) bool {
+	if len(targetLabels) == 0 {
+		return false
+	}
+	for _, pdb := range pdbs {
+		if pdb.Namespace != namespace {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(targetLabels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkpointTotalSamples maps container name to the TotalSamples recorded in
+// that container's VerticalPodAutoscalerCheckpoint, for the VPA named
+// vpaName. Checkpoints are matched by spec.vpaObjectName/spec.containerName
+// rather than by a naming convention on the checkpoint's own name, since
+// upstream doesn't guarantee one.
+func checkpointTotalSamples(ctx context.Context, dynamicClient dynamic.Interface, namespace, vpaName string) (map[string]int, error) {
+	checkpoints, err := dynamicClient.Resource(checkpointGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing VerticalPodAutoscalerCheckpoints in namespace %s: %v", namespace, err)
+	}
+
+	result := make(map[string]int)
+	for _, checkpoint := range checkpoints.Items {
+		owner, _, _ := unstructured.NestedString(checkpoint.Object, "spec", "vpaObjectName")
+		if owner != vpaName {
+			continue
+		}
+		containerName, _, _ := unstructured.NestedString(checkpoint.Object, "spec", "containerName")
+		total, found, err := unstructured.NestedInt64(checkpoint.Object, "status", "totalSamples")
+		if err != nil || !found {
+			continue
+		}
+		result[containerName] = int(total)
+	}
+	return result, nil
+}
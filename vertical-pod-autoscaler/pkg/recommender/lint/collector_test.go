@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func newUnstructuredVPA(namespace, name, updateMode, targetName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling.k8s.io/v1",
+		"kind":       "VerticalPodAutoscaler",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"targetRef": map[string]interface{}{
+				"kind": "Deployment",
+				"name": targetName,
+			},
+			"updatePolicy": map[string]interface{}{
+				"updateMode": updateMode,
+			},
+			"resourcePolicy": map[string]interface{}{
+				"containerPolicies": []interface{}{
+					map[string]interface{}{
+						"containerName": "app",
+						"minAllowed":    map[string]interface{}{"memory": "100"},
+						"maxAllowed":    map[string]interface{}{"memory": "2000"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"recommendation": map[string]interface{}{
+				"containerRecommendations": []interface{}{
+					map[string]interface{}{
+						"containerName": "app",
+						"lowerBound":    map[string]interface{}{"memory": "900"},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func newUnstructuredDeployment(namespace, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"app": name},
+				},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":      "app",
+							"resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "1024"}},
+							"env": []interface{}{
+								map[string]interface{}{"name": "OVERRIDE_JVM_HEAP_SIZE", "value": "512"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func newUnstructuredCheckpoint(namespace, vpaName, containerName string, totalSamples int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling.k8s.io/v1",
+		"kind":       "VerticalPodAutoscalerCheckpoint",
+		"metadata": map[string]interface{}{
+			"name":      vpaName + "-" + containerName,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"vpaObjectName": vpaName,
+			"containerName": containerName,
+		},
+		"status": map[string]interface{}{
+			"totalSamples": totalSamples,
+		},
+	}}
+}
+
+func TestCollectVPAStateAssemblesStateFromClusterObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		vpaGVR:        "VerticalPodAutoscalerList",
+		checkpointGVR: "VerticalPodAutoscalerCheckpointList",
+		deploymentGVR: "DeploymentList",
+	},
+		newUnstructuredVPA("ns", "my-vpa", "Auto", "my-deploy"),
+		newUnstructuredDeployment("ns", "my-deploy"),
+		newUnstructuredCheckpoint("ns", "my-vpa", "app", 42),
+	)
+	kubeClient := fake.NewSimpleClientset(&policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "my-pdb"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "my-deploy"}},
+		},
+	})
+
+	states, err := CollectVPAState(context.Background(), dynamicClient, kubeClient, "ns")
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+
+	state := states[0]
+	assert.Equal(t, "my-vpa", state.Name)
+	assert.Equal(t, "Auto", state.UpdateMode)
+	assert.True(t, state.HasPDB)
+	require.Len(t, state.Containers, 1)
+
+	container := state.Containers[0]
+	assert.Equal(t, "app", container.ContainerName)
+	assert.Equal(t, model.ResourceAmount(900), container.RecommendationFloor)
+	assert.Equal(t, model.ResourceAmount(512), container.JVMHeapOverride)
+	assert.Equal(t, 42, container.RSSSampleCount)
+	assert.Equal(t, model.ResourceAmount(1024), container.MemoryLimit)
+	assert.Equal(t, model.ResourceAmount(100), container.MinAllowed[model.ResourceMemory])
+	assert.Equal(t, model.ResourceAmount(2000), container.MaxAllowed[model.ResourceMemory])
+}
+
+func TestCollectVPAStateNoPDBWhenSelectorDoesNotMatch(t *testing.T) {
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		vpaGVR:        "VerticalPodAutoscalerList",
+		checkpointGVR: "VerticalPodAutoscalerCheckpointList",
+		deploymentGVR: "DeploymentList",
+	},
+		newUnstructuredVPA("ns", "my-vpa", "Recreate", "my-deploy"),
+		newUnstructuredDeployment("ns", "my-deploy"),
+	)
+	kubeClient := fake.NewSimpleClientset(&policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "unrelated-pdb"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "something-else"}},
+		},
+	})
+
+	states, err := CollectVPAState(context.Background(), dynamicClient, kubeClient, "ns")
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.False(t, states[0].HasPDB)
+	assert.Equal(t, "Recreate", states[0].UpdateMode)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Text renders the report as one line per finding, the format the
+// `vpa-recommender-lint` command prints by default:
+//
+//	namespace/vpa-name[container]: rule: message
+func (r Report) Text() string {
+	if len(r.Findings) == 0 {
+		return "no findings\n"
+	}
+
+	var b strings.Builder
+	for _, f := range r.Findings {
+		target := fmt.Sprintf("%s/%s", f.Namespace, f.VPAName)
+		if f.Container != "" {
+			target = fmt.Sprintf("%s[%s]", target, f.Container)
+		}
+		fmt.Fprintf(&b, "%s: %s: %s\n", target, f.Rule, f.Message)
+	}
+	return b.String()
+}
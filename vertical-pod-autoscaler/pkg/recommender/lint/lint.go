@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lint statically evaluates VPA recommendation history and current
+// state for configurations that are technically valid but are either
+// guaranteed to misbehave (e.g. a recommendation floor below a container's
+// own OVERRIDE_JVM_HEAP_SIZE) or make the recommendation untrustworthy (e.g.
+// too few samples). It backs the `vpa-recommender-lint` command and reuses
+// the recommender's own model package so it evaluates the same state the
+// recommender acted on, rather than re-deriving it from raw metrics.
+package lint
+
+import (
+	"encoding/json"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// Rule names a single lint check, stable across releases so CI configs can
+// allow-list or gate on specific rules.
+type Rule string
+
+const (
+	// RuleJVMHeapFloorBelowOverride fires when a container's recommendation
+	// floor for memory is below its own OVERRIDE_JVM_HEAP_SIZE: the
+	// recommendation guarantees an OOM kill as soon as the JVM heap grows to
+	// the size it was told to expect.
+	RuleJVMHeapFloorBelowOverride Rule = "jvm-heap-floor-below-override"
+	// RuleInsufficientSamples fires when a container's RSS histogram has
+	// fewer than Lint's minSamples observations, so its recommendation percentile
+	// is still mostly prior and shouldn't be trusted.
+	RuleInsufficientSamples Rule = "insufficient-samples"
+	// RuleJVMHeapExceedsLimit fires when a container's observed
+	// JVMHeapCommitted usage regularly exceeds its memory limit minus the
+	// per-container overhead reserved for non-heap memory, which is a
+	// leading indicator of an imminent OOM kill.
+	RuleJVMHeapExceedsLimit Rule = "jvm-heap-exceeds-limit"
+	// RuleMinExceedsMax fires when a VPA's ContainerResourcePolicy has
+	// MinAllowed > MaxAllowed for some resource, which the admission webhook
+	// will reject outright.
+	RuleMinExceedsMax Rule = "min-allowed-exceeds-max-allowed"
+	// RuleAutoUpdateWithoutPDB fires when a VPA's updateMode is Auto or
+	// Recreate (VPA is allowed to evict and recreate pods to apply a
+	// recommendation) but the target has no PodDisruptionBudget, so
+	// VPA-driven evictions aren't rate limited.
+	RuleAutoUpdateWithoutPDB Rule = "auto-update-without-pdb"
+)
+
+// Finding is one actionable warning produced by a check.
+type Finding struct {
+	Rule      Rule   `json:"rule"`
+	Namespace string `json:"namespace"`
+	VPAName   string `json:"vpaName"`
+	Container string `json:"container,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Report is the result of linting one or more VPAs. Ops tooling that wants
+// to consume findings programmatically (rather than through the CLI's text
+// or JSON output) should operate on this struct directly.
+type Report struct {
+	Findings []Finding `json:"findings"`
+}
+
+// HasFindings reports whether any check fired, which is what the CLI uses to
+// decide its exit code.
+func (r Report) HasFindings() bool {
+	return len(r.Findings) > 0
+}
+
+// JSON renders the report as indented JSON.
+func (r Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// ContainerState is the subset of a VPA-tracked container's recommendation
+// history and current state that the linter's checks need.
+type ContainerState struct {
+	ContainerName string
+
+	// RecommendationFloor is the lower bound of the memory recommendation
+	// the recommender currently produces for this container (e.g. its
+	// percentile-based target minus safety margin).
+	RecommendationFloor model.ResourceAmount
+	// JVMHeapOverride is the parsed OVERRIDE_JVM_HEAP_SIZE env value for this
+	// container, or 0 if it isn't set.
+	JVMHeapOverride model.ResourceAmount
+
+	// RSSSampleCount is the number of RSS samples the recommender has
+	// collected for this container.
+	RSSSampleCount int
+
+	// JVMHeapCommittedP99 is the 99th percentile of observed
+	// JVMHeapCommitted usage for this container, or 0 if the metric isn't
+	// being collected.
+	JVMHeapCommittedP99 model.ResourceAmount
+	// MemoryLimit is the container's current memory limit, or 0 if unset.
+	MemoryLimit model.ResourceAmount
+	// MemoryOverhead is the amount of a container's memory limit that's
+	// assumed to be used by non-heap memory (thread stacks, metaspace,
+	// direct buffers, ...) and so isn't available to the heap.
+	MemoryOverhead model.ResourceAmount
+
+	MinAllowed model.Resources
+	MaxAllowed model.Resources
+}
+
+// VPAState is the subset of a VPA object's spec/status the linter needs.
+type VPAState struct {
+	Namespace  string
+	Name       string
+	UpdateMode string
+	HasPDB     bool
+	Containers []ContainerState
+}
+
+// MinSamplesDefault is used by Lint callers that don't have a stronger
+// opinion about how many RSS samples make a recommendation trustworthy.
+const MinSamplesDefault = 30
+
+// Lint runs every check against vpas and returns the combined findings.
+// minSamples overrides MinSamplesDefault for RuleInsufficientSamples; pass
+// MinSamplesDefault to use the recommender's own default.
+func Lint(vpas []VPAState, minSamples int) Report {
+	var findings []Finding
+	for _, vpa := range vpas {
+		findings = append(findings, checkMinExceedsMax(vpa)...)
+		findings = append(findings, checkAutoUpdateWithoutPDB(vpa)...)
+		for _, container := range vpa.Containers {
+			findings = append(findings, checkJVMHeapFloorBelowOverride(vpa, container)...)
+			findings = append(findings, checkInsufficientSamples(vpa, container, minSamples)...)
+			findings = append(findings, checkJVMHeapExceedsLimit(vpa, container)...)
+		}
+	}
+	return Report{Findings: findings}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func TestLintCleanVPAProducesNoFindings(t *testing.T) {
+	vpas := []VPAState{
+		{
+			Namespace:  "ns",
+			Name:       "clean-vpa",
+			UpdateMode: "Auto",
+			HasPDB:     true,
+			Containers: []ContainerState{
+				{
+					ContainerName:       "app",
+					RecommendationFloor: 1024,
+					RSSSampleCount:      100,
+					MinAllowed:          model.Resources{model.ResourceMemory: 100},
+					MaxAllowed:          model.Resources{model.ResourceMemory: 2000},
+				},
+			},
+		},
+	}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	assert.False(t, report.HasFindings())
+}
+
+func TestLintJVMHeapFloorBelowOverride(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace: "ns", Name: "vpa",
+		Containers: []ContainerState{{
+			ContainerName:       "app",
+			RecommendationFloor: 256,
+			JVMHeapOverride:     512,
+			RSSSampleCount:      100,
+		}},
+	}}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleJVMHeapFloorBelowOverride, report.Findings[0].Rule)
+	}
+}
+
+func TestLintInsufficientSamples(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace: "ns", Name: "vpa",
+		Containers: []ContainerState{{ContainerName: "app", RSSSampleCount: 3}},
+	}}
+
+	report := Lint(vpas, 30)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleInsufficientSamples, report.Findings[0].Rule)
+	}
+}
+
+func TestLintJVMHeapExceedsLimit(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace: "ns", Name: "vpa",
+		Containers: []ContainerState{{
+			ContainerName:       "app",
+			RSSSampleCount:      100,
+			JVMHeapCommittedP99: 1800,
+			MemoryLimit:         2000,
+			MemoryOverhead:      400,
+		}},
+	}}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleJVMHeapExceedsLimit, report.Findings[0].Rule)
+	}
+}
+
+func TestLintMinExceedsMax(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace: "ns", Name: "vpa",
+		Containers: []ContainerState{{
+			ContainerName:  "app",
+			RSSSampleCount: 100,
+			MinAllowed:     model.Resources{model.ResourceMemory: 2000},
+			MaxAllowed:     model.Resources{model.ResourceMemory: 1000},
+		}},
+	}}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleMinExceedsMax, report.Findings[0].Rule)
+	}
+}
+
+func TestLintAutoUpdateWithoutPDB(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace:  "ns",
+		Name:       "vpa",
+		UpdateMode: "Auto",
+		HasPDB:     false,
+		Containers: []ContainerState{{ContainerName: "app", RSSSampleCount: 100}},
+	}}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleAutoUpdateWithoutPDB, report.Findings[0].Rule)
+	}
+}
+
+func TestLintRecreateUpdateWithoutPDB(t *testing.T) {
+	vpas := []VPAState{{
+		Namespace:  "ns",
+		Name:       "vpa",
+		UpdateMode: "Recreate",
+		HasPDB:     false,
+		Containers: []ContainerState{{ContainerName: "app", RSSSampleCount: 100}},
+	}}
+
+	report := Lint(vpas, MinSamplesDefault)
+
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, RuleAutoUpdateWithoutPDB, report.Findings[0].Rule)
+	}
+}
+
+func TestReportTextAndJSON(t *testing.T) {
+	report := Report{Findings: []Finding{{
+		Rule: RuleInsufficientSamples, Namespace: "ns", VPAName: "vpa", Container: "app", Message: "not enough samples",
+	}}}
+
+	assert.Contains(t, report.Text(), "ns/vpa[app]: insufficient-samples: not enough samples")
+
+	data, err := report.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "\"insufficient-samples\"")
+}
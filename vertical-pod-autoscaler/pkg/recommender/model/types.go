@@ -0,0 +1,90 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model holds the recommender's in-memory representation of cluster
+// state: pods, containers, and the resource usage samples collected for
+// them. It has no dependency on how that state was collected (Prometheus,
+// pod status, cgroupfs, ...), so input sources and the recommender logic
+// itself can share a single vocabulary for "which container" and "how much
+// of what resource".
+package model
+
+// PodID identifies a pod within a cluster.
+type PodID struct {
+	// Namespace the pod lives in.
+	Namespace string
+	// PodName is the pod's name.
+	PodName string
+}
+
+// ContainerID identifies a single container within a pod.
+type ContainerID struct {
+	PodID
+	// ContainerName is the name of the container within the pod.
+	ContainerName string
+}
+
+// ResourceName is the name of a resource tracked by the recommender, e.g.
+// "cpu" or "memory", or one of the custom resources derived from
+// application-level metrics (RSS, JVM heap, GPU memory, ...).
+type ResourceName string
+
+// ResourceAmount represents a quantity of a given resource, in the resource's
+// natural unit: cores for ResourceCPU, bytes for memory-like resources,
+// count for pids, seconds for GC pause time.
+type ResourceAmount int64
+
+// Resources is a set of resource amounts, keyed by resource name, e.g. a
+// container's recommended requests or a namespace's quota limits.
+type Resources map[ResourceName]ResourceAmount
+
+const (
+	// ResourceCPU represents CPU in cores.
+	ResourceCPU ResourceName = "cpu"
+	// ResourceMemory represents memory, in bytes.
+	ResourceMemory ResourceName = "memory"
+
+	// ResourceRSS is the process resident set size, in bytes, as reported by
+	// container_memory_rss.
+	ResourceRSS ResourceName = "rss"
+
+	// ResourceJVMHeapCommitted is a JVM's committed heap size, in bytes.
+	ResourceJVMHeapCommitted ResourceName = "jvmHeapCommitted"
+	// ResourceJVMHeapUsed is a JVM's used heap size, in bytes.
+	ResourceJVMHeapUsed ResourceName = "jvmHeapUsed"
+	// ResourceJVMNonHeapCommitted is a JVM's committed non-heap size
+	// (code cache, compressed class space, ...), in bytes.
+	ResourceJVMNonHeapCommitted ResourceName = "jvmNonHeapCommitted"
+	// ResourceJVMMetaspaceUsed is a JVM's used metaspace, in bytes.
+	ResourceJVMMetaspaceUsed ResourceName = "jvmMetaspaceUsed"
+	// ResourceJVMDirectMemoryUsed is a JVM's used direct (off-heap) buffer
+	// memory, in bytes.
+	ResourceJVMDirectMemoryUsed ResourceName = "jvmDirectMemoryUsed"
+	// ResourceJVMGCPauseSeconds is cumulative JVM garbage collection pause
+	// time, in seconds.
+	ResourceJVMGCPauseSeconds ResourceName = "jvmGCPauseSeconds"
+
+	// ResourceGPUMemory is NVIDIA device framebuffer memory used by a
+	// container's pod, in bytes, as reported by DCGM_FI_DEV_FB_USED.
+	ResourceGPUMemory ResourceName = "gpuMemory"
+
+	// ResourceEphemeralStorage is a container's ephemeral (writable layer +
+	// emptyDir) filesystem usage, in bytes.
+	ResourceEphemeralStorage ResourceName = "ephemeral-storage"
+	// ResourcePID is the number of processes running in a container's pid
+	// namespace.
+	ResourcePID ResourceName = "pids"
+)